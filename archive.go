@@ -0,0 +1,388 @@
+// postgresctl/archive.go
+package postgresctl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type ArchiveController interface {
+	ArchiveDatabase(dbName, requester string) (ArchivedDatabase, error)
+	ListArchivedDatabases() ([]ArchivedDatabase, error)
+	RestoreDatabase(tombstone string) error
+	PurgeDatabase(tombstone string) error
+	PurgeArchivedDatabases(retention time.Duration) ([]string, error)
+}
+
+var _ ArchiveController = &PostgresController{}
+
+const (
+	archivePrefix        = "pgctl_archive_"
+	archiveCommentPrefix = "pgctl:archive "
+	// PostgreSQL truncates identifiers longer than this
+	maxIdentifierLength = 63
+
+	defaultArchiveReaperInterval = time.Hour
+)
+
+var (
+	ErrNotArchived = fmt.Errorf("database is not archived")
+)
+
+// ArchivedDatabase is a tombstone left by ArchiveDatabase. The metadata is
+// kept in the tombstone's comment, along with whatever comment it had before.
+type ArchivedDatabase struct {
+	Tombstone        string    `json:"-"`
+	OriginalName     string    `json:"original_name"`
+	DeletedAt        time.Time `json:"deleted_at"`
+	RequestedBy      string    `json:"requested_by"`
+	Comment          string    `json:"comment,omitempty"`
+	AllowConnections bool      `json:"allow_connections"`
+}
+
+// ArchiveDatabase soft-deletes dbName: it is renamed to a tombstone name,
+// closed for connections and hidden from ListDatabases until it is restored
+// or purged. An empty requester records the controller's login.
+func (c *PostgresController) ArchiveDatabase(dbName, requester string) (ArchivedDatabase, error) {
+	if err := validateDBName(dbName); err != nil {
+		return ArchivedDatabase{}, err
+	}
+	if isArchivedDatabaseName(dbName) {
+		return ArchivedDatabase{}, fmt.Errorf("%s is already archived", dbName)
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return ArchivedDatabase{}, err
+	}
+
+	if requester == "" {
+		err := c.db.QueryRow(`SELECT session_user`).Scan(&requester)
+		if err != nil {
+			return ArchivedDatabase{}, fmt.Errorf("error getting requester: %w", err)
+		}
+	}
+
+	allowConn, err := c.databaseAllowsConnections(dbName)
+	if err != nil {
+		return ArchivedDatabase{}, err
+	}
+
+	comment, err := c.databaseComment(dbName)
+	if err != nil {
+		return ArchivedDatabase{}, err
+	}
+
+	archived := ArchivedDatabase{
+		OriginalName:     dbName,
+		DeletedAt:        time.Now().UTC().Truncate(time.Second),
+		RequestedBy:      requester,
+		Comment:          comment,
+		AllowConnections: allowConn,
+	}
+	archived.Tombstone = tombstoneName(dbName, archived.DeletedAt)
+
+	meta, err := json.Marshal(archived)
+	if err != nil {
+		return ArchivedDatabase{}, err
+	}
+
+	// The comment is written first, it follows the database through the
+	// rename and a failed step only has to undo the steps before it
+	err = c.setDatabaseComment(dbName, archiveCommentPrefix+string(meta))
+	if err != nil {
+		return ArchivedDatabase{}, err
+	}
+	rollback := func(err error) error {
+		if allowConn {
+			err = errors.Join(err, c.setAllowConnections(dbName, true))
+		}
+		return errors.Join(err, c.setDatabaseComment(dbName, archived.Comment))
+	}
+
+	if allowConn {
+		if err := c.setAllowConnections(dbName, false); err != nil {
+			allowConn = false
+			return ArchivedDatabase{}, rollback(err)
+		}
+	}
+
+	err = c.renameDatabase(dbName, archived.Tombstone)
+	if err != nil {
+		return ArchivedDatabase{}, rollback(err)
+	}
+
+	return archived, nil
+}
+
+func (c *PostgresController) ListArchivedDatabases() ([]ArchivedDatabase, error) {
+	rows, err := c.db.Query(`
+		SELECT datname, COALESCE(pg_catalog.shobj_description(oid, 'pg_database'), '')
+		FROM pg_database
+		WHERE datname LIKE 'pgctl\_archive\_%'
+		ORDER BY datname
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing archived databases: %w", err)
+	}
+	defer rows.Close()
+
+	var archived []ArchivedDatabase
+	for rows.Next() {
+		var name, comment string
+		if err := rows.Scan(&name, &comment); err != nil {
+			return nil, fmt.Errorf("error scanning archived database: %w", err)
+		}
+
+		// Databases that merely look like tombstones are not ours to list
+		a, err := parseArchiveComment(name, comment)
+		if err != nil {
+			continue
+		}
+		archived = append(archived, a)
+	}
+
+	return archived, rows.Err()
+}
+
+// RestoreDatabase renames a tombstone back to its original name and restores
+// its comment and connection settings.
+func (c *PostgresController) RestoreDatabase(tombstone string) error {
+	archived, err := c.archivedDatabase(tombstone)
+	if err != nil {
+		return err
+	}
+	if err := validateDBName(archived.OriginalName); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	err = c.renameDatabase(tombstone, archived.OriginalName)
+	if err != nil {
+		return err
+	}
+	// A failed step puts the tombstone back as it was, so it is still
+	// listed and can be restored again
+	commentRestored := false
+	rollback := func(err error) error {
+		if commentRestored {
+			meta, merr := json.Marshal(archived)
+			if merr == nil {
+				merr = c.setDatabaseComment(archived.OriginalName, archiveCommentPrefix+string(meta))
+			}
+			err = errors.Join(err, merr)
+		}
+		return errors.Join(err, c.renameDatabase(archived.OriginalName, tombstone))
+	}
+
+	err = c.setDatabaseComment(archived.OriginalName, archived.Comment)
+	if err != nil {
+		return rollback(err)
+	}
+	commentRestored = true
+
+	if archived.AllowConnections {
+		if err := c.setAllowConnections(archived.OriginalName, true); err != nil {
+			return rollback(err)
+		}
+	}
+	return nil
+}
+
+// PurgeDatabase permanently drops a tombstone.
+func (c *PostgresController) PurgeDatabase(tombstone string) error {
+	if _, err := c.archivedDatabase(tombstone); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	_, err := c.db.Exec(fmt.Sprintf("DROP DATABASE \"%s\"", tombstone))
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			return ErrDBDoesNotExist
+		}
+		return fmt.Errorf("error dropping database: %w", err)
+	}
+	return nil
+}
+
+// PurgeArchivedDatabases drops tombstones archived more than retention ago
+// and returns their names. A tombstone that can't be dropped doesn't stop the
+// others, the errors are returned joined.
+func (c *PostgresController) PurgeArchivedDatabases(retention time.Duration) ([]string, error) {
+	archived, err := c.ListArchivedDatabases()
+	if err != nil {
+		return nil, err
+	}
+
+	var purged []string
+	var errs []error
+	cutoff := time.Now().Add(-retention)
+	for _, a := range archived {
+		if a.DeletedAt.After(cutoff) {
+			continue
+		}
+		if err := c.PurgeDatabase(a.Tombstone); err != nil {
+			errs = append(errs, fmt.Errorf("error purging %s: %w", a.Tombstone, err))
+			continue
+		}
+		purged = append(purged, a.Tombstone)
+	}
+
+	return purged, errors.Join(errs...)
+}
+
+func (c *PostgresController) archivedDatabase(tombstone string) (ArchivedDatabase, error) {
+	if err := validateDBName(tombstone); err != nil {
+		return ArchivedDatabase{}, err
+	}
+	if !isArchivedDatabaseName(tombstone) {
+		return ArchivedDatabase{}, ErrNotArchived
+	}
+
+	comment, err := c.databaseComment(tombstone)
+	if err != nil {
+		return ArchivedDatabase{}, err
+	}
+
+	return parseArchiveComment(tombstone, comment)
+}
+
+func (c *PostgresController) databaseComment(dbName string) (string, error) {
+	var comment sql.NullString
+	err := c.db.QueryRow(`
+		SELECT pg_catalog.shobj_description(oid, 'pg_database')
+		FROM pg_database
+		WHERE datname = $1
+	`, dbName).Scan(&comment)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrDBDoesNotExist
+		}
+		return "", fmt.Errorf("error getting database comment: %w", err)
+	}
+	return comment.String, nil
+}
+
+func (c *PostgresController) setDatabaseComment(dbName, comment string) error {
+	value := "NULL"
+	if comment != "" {
+		value = quoteLiteral(comment)
+	}
+
+	_, err := c.db.Exec(`COMMENT ON DATABASE "` + dbName + `" IS ` + value)
+	if err != nil {
+		return fmt.Errorf("error setting database comment: %w", err)
+	}
+	return nil
+}
+
+type ArchiveReaper struct {
+	c         *PostgresController
+	retention time.Duration
+	interval  time.Duration
+	handler   func(purged []string, err error)
+}
+
+type ArchiveReaperOption func(*ArchiveReaper)
+
+func WithArchiveReaperInterval(interval time.Duration) ArchiveReaperOption {
+	return func(r *ArchiveReaper) {
+		r.interval = interval
+	}
+}
+
+// WithArchiveReaperHandler is called after every pass with the purged tombstones
+func WithArchiveReaperHandler(handler func(purged []string, err error)) ArchiveReaperOption {
+	return func(r *ArchiveReaper) {
+		r.handler = handler
+	}
+}
+
+func NewArchiveReaper(c *PostgresController, retention time.Duration, opts ...ArchiveReaperOption) (*ArchiveReaper, error) {
+	if retention < 0 {
+		return nil, fmt.Errorf("archive retention cannot be negative")
+	}
+
+	r := &ArchiveReaper{c: c, retention: retention, interval: defaultArchiveReaperInterval}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.interval <= 0 {
+		return nil, fmt.Errorf("archive reaper interval must be positive")
+	}
+
+	return r, nil
+}
+
+// Run purges expired tombstones every interval until ctx is done.
+func (r *ArchiveReaper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := r.c.PurgeArchivedDatabases(r.retention)
+		if r.handler != nil {
+			r.handler(purged, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func parseArchiveComment(tombstone, comment string) (ArchivedDatabase, error) {
+	meta, ok := strings.CutPrefix(comment, archiveCommentPrefix)
+	if !ok {
+		return ArchivedDatabase{}, fmt.Errorf("%w: %s has no archive metadata", ErrNotArchived, tombstone)
+	}
+
+	var archived ArchivedDatabase
+	if err := json.Unmarshal([]byte(meta), &archived); err != nil {
+		return ArchivedDatabase{}, fmt.Errorf("error parsing archive metadata of %s: %w", tombstone, err)
+	}
+	archived.Tombstone = tombstone
+	return archived, nil
+}
+
+func tombstoneName(dbName string, deletedAt time.Time) string {
+	name := fmt.Sprintf("%s%d_%s", archivePrefix, deletedAt.Unix(), dbName)
+	if len(name) > maxIdentifierLength {
+		name = name[:maxIdentifierLength]
+	}
+	// Don't leave half a multi-byte character behind
+	for !utf8.ValidString(name) {
+		name = name[:len(name)-1]
+	}
+	return name
+}
+
+func isArchivedDatabaseName(dbName string) bool {
+	return strings.HasPrefix(dbName, archivePrefix)
+}
+
+func filterArchivedDatabases(dbs []string) []string {
+	var filtered []string
+	for _, db := range dbs {
+		if !isArchivedDatabaseName(db) {
+			filtered = append(filtered, db)
+		}
+	}
+	return filtered
+}
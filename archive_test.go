@@ -0,0 +1,158 @@
+// postgresctl/archive_test.go
+package postgresctl
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTombstoneName(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+
+	name := tombstoneName("tenant", at)
+	assert.Equal(t, "pgctl_archive_1700000000_tenant", name)
+	assert.True(t, isArchivedDatabaseName(name))
+	assert.False(t, isArchivedDatabaseName("tenant"))
+
+	long := tombstoneName(strings.Repeat("ж", 40), at)
+	assert.LessOrEqual(t, len(long), maxIdentifierLength)
+	assert.True(t, strings.HasPrefix(long, archivePrefix))
+
+	_, err := parseArchiveComment(name, "a regular comment")
+	assert.ErrorIs(t, err, ErrNotArchived)
+
+	archived, err := parseArchiveComment(name, archiveCommentPrefix+`{"original_name":"tenant","requested_by":"alice","allow_connections":true}`)
+	assert.NoError(t, err)
+	assert.Equal(t, ArchivedDatabase{Tombstone: name, OriginalName: "tenant", RequestedBy: "alice", AllowConnections: true}, archived)
+}
+
+func TestPostgresController_ArchiveAndRestoreDatabase(t *testing.T) {
+	testDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	_, err := c.ArchiveDatabase(testDB, "alice")
+	assert.Equal(t, ErrDBDoesNotExist, err)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	err = c.setDatabaseComment(testDB, "tenant database")
+	assert.NoError(t, err)
+
+	archived, err := c.ArchiveDatabase(testDB, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, testDB, archived.OriginalName)
+	assert.Equal(t, "alice", archived.RequestedBy)
+	assert.True(t, archived.AllowConnections)
+
+	exists, err := c.DatabaseExists(testDB)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	dbs, err := c.ListDatabases()
+	assert.NoError(t, err)
+	assert.NotContains(t, dbs, archived.Tombstone)
+
+	allowConn, err := c.databaseAllowsConnections(archived.Tombstone)
+	assert.NoError(t, err)
+	assert.False(t, allowConn)
+
+	list, err := c.ListArchivedDatabases()
+	assert.NoError(t, err)
+	assert.Contains(t, list, archived)
+
+	err = c.RestoreDatabase(testDB)
+	assert.Equal(t, ErrNotArchived, err)
+
+	err = c.RestoreDatabase(archived.Tombstone)
+	assert.NoError(t, err)
+
+	info, err := c.DescribeDatabase(testDB)
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant database", info.Comment)
+	assert.True(t, info.AllowConnections)
+}
+
+func TestPostgresController_ArchiveOnDeleteAndPurge(t *testing.T) {
+	testDB := testDB()
+
+	c, err := NewPostgresController(pc, WithArchiveOnDelete())
+	assert.NoError(t, err)
+	defer c.Close()
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+
+	err = c.DeleteDatabase(testDB)
+	assert.NoError(t, err)
+
+	var tombstone string
+	list, err := c.ListArchivedDatabases()
+	assert.NoError(t, err)
+	for _, a := range list {
+		if a.OriginalName == testDB {
+			tombstone = a.Tombstone
+			assert.Equal(t, "postgres", a.RequestedBy)
+		}
+	}
+	assert.NotEmpty(t, tombstone)
+
+	// Nothing is old enough yet
+	purged, err := c.PurgeArchivedDatabases(time.Hour)
+	assert.NoError(t, err)
+	assert.NotContains(t, purged, tombstone)
+
+	var handled []string
+	r, err := NewArchiveReaper(c, 0, WithArchiveReaperHandler(func(purged []string, err error) {
+		assert.NoError(t, err)
+		handled = append(handled, purged...)
+	}))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	err = r.Run(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, handled, tombstone)
+
+	exists, err := c.DatabaseExists(tombstone)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestPostgresController_PurgeArchivedDatabases_KeepsGoing(t *testing.T) {
+	c := createTestController()
+	defer c.Close()
+
+	var tombstones []string
+	for i := 0; i < 2; i++ {
+		testDB := testDB()
+		err := c.CreateDatabase(testDB)
+		assert.NoError(t, err)
+
+		archived, err := c.ArchiveDatabase(testDB, "")
+		assert.NoError(t, err)
+		tombstones = append(tombstones, archived.Tombstone)
+	}
+
+	// Template databases can't be dropped
+	_, err := c.db.Exec(`ALTER DATABASE "` + tombstones[0] + `" IS_TEMPLATE true`)
+	assert.NoError(t, err)
+	defer func() {
+		c.db.Exec(`ALTER DATABASE "` + tombstones[0] + `" IS_TEMPLATE false`)
+		c.PurgeDatabase(tombstones[0])
+	}()
+
+	purged, err := c.PurgeArchivedDatabases(0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), tombstones[0])
+	assert.NotContains(t, purged, tombstones[0])
+	assert.Contains(t, purged, tombstones[1])
+}
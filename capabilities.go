@@ -0,0 +1,106 @@
+// postgresctl/capabilities.go
+package postgresctl
+
+import (
+	"fmt"
+)
+
+var (
+	ErrUnsupportedByServer = fmt.Errorf("not supported by this server version")
+)
+
+// Versions as in server_version_num
+const (
+	postgres12 = 120000
+	postgres13 = 130000
+	postgres14 = 140000
+	postgres15 = 150000
+	postgres16 = 160000
+	postgres17 = 170000
+	postgres18 = 180000
+
+	// minSupportedVersion is the oldest server a controller connects to
+	minSupportedVersion = postgres12
+)
+
+// Capabilities lists server features whose SQL differs between versions.
+type Capabilities struct {
+	// VersionNum is server_version_num, e.g. 160004
+	VersionNum   int
+	Version      string
+	MajorVersion int
+
+	// PUBLIC may create objects in the public schema of new databases (< 15)
+	PublicSchemaCreate bool
+	// DROP DATABASE ... WITH (FORCE) (13+)
+	DropDatabaseForce bool
+	// LOCALE_PROVIDER icu for databases (15+)
+	ICULocaleProvider bool
+	// LOCALE_PROVIDER builtin for databases (17+)
+	BuiltinLocaleProvider bool
+	// GRANT role TO role WITH INHERIT/SET (16+)
+	GrantWithInherit bool
+	// MAINTAIN privilege on tables (17+)
+	MaintainPrivilege bool
+}
+
+func capabilitiesFor(versionNum int, version string) Capabilities {
+	return Capabilities{
+		VersionNum:            versionNum,
+		Version:               version,
+		MajorVersion:          versionNum / 10000,
+		PublicSchemaCreate:    versionNum < postgres15,
+		DropDatabaseForce:     versionNum >= postgres13,
+		ICULocaleProvider:     versionNum >= postgres15,
+		BuiltinLocaleProvider: versionNum >= postgres17,
+		GrantWithInherit:      versionNum >= postgres16,
+		MaintainPrivilege:     versionNum >= postgres17,
+	}
+}
+
+// Capabilities returns the server features detected when the controller was
+// created, they are cached for the controller's lifetime.
+func (c *PostgresController) Capabilities() (Capabilities, error) {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+
+	if c.caps != nil {
+		return *c.caps, nil
+	}
+
+	var versionNum int
+	var version string
+	err := c.db.QueryRow(`SELECT current_setting('server_version_num')::int, current_setting('server_version')`).Scan(&versionNum, &version)
+	if err != nil {
+		return Capabilities{}, fmt.Errorf("error detecting server version: %w", err)
+	}
+
+	caps := capabilitiesFor(versionNum, version)
+	c.caps = &caps
+	return caps, nil
+}
+
+// checkServerVersion detects the capabilities and rejects servers older
+// than minSupportedVersion.
+func (c *PostgresController) checkServerVersion() error {
+	caps, err := c.Capabilities()
+	if err != nil {
+		return err
+	}
+	if caps.VersionNum < minSupportedVersion {
+		return fmt.Errorf("%w: PostgreSQL %d or later is required, server is %s", ErrUnsupportedByServer, minSupportedVersion/10000, caps.Version)
+	}
+	return nil
+}
+
+// requireVersion returns ErrUnsupportedByServer if the server is older than minVersionNum
+func (c *PostgresController) requireVersion(feature string, minVersionNum int) error {
+	caps, err := c.Capabilities()
+	if err != nil {
+		return err
+	}
+	if caps.VersionNum < minVersionNum {
+		return fmt.Errorf("%w: %s requires PostgreSQL %d, server is %s", ErrUnsupportedByServer, feature, minVersionNum/10000, caps.Version)
+	}
+	return nil
+}
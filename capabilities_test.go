@@ -0,0 +1,133 @@
+// postgresctl/capabilities_test.go
+package postgresctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilitiesFor(t *testing.T) {
+	caps := capabilitiesFor(120019, "12.19")
+	assert.Equal(t, 12, caps.MajorVersion)
+	assert.True(t, caps.PublicSchemaCreate)
+	assert.False(t, caps.DropDatabaseForce)
+	assert.False(t, caps.ICULocaleProvider)
+
+	caps = capabilitiesFor(160004, "16.4")
+	assert.Equal(t, 16, caps.MajorVersion)
+	assert.False(t, caps.PublicSchemaCreate)
+	assert.True(t, caps.DropDatabaseForce)
+	assert.True(t, caps.ICULocaleProvider)
+	assert.True(t, caps.GrantWithInherit)
+	assert.False(t, caps.MaintainPrivilege)
+	assert.False(t, caps.BuiltinLocaleProvider)
+
+	caps = capabilitiesFor(170000, "17.0")
+	assert.True(t, caps.MaintainPrivilege)
+	assert.True(t, caps.BuiltinLocaleProvider)
+}
+
+func TestPostgresController_Capabilities(t *testing.T) {
+	c := createTestController()
+	defer c.Close()
+
+	caps, err := c.Capabilities()
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, caps.VersionNum, postgres12)
+	assert.NotEmpty(t, caps.Version)
+
+	err = c.requireVersion("time travel", 990000)
+	assert.ErrorIs(t, err, ErrUnsupportedByServer)
+	assert.NoError(t, c.requireVersion("export", minSupportedVersion))
+}
+
+func TestPostgresController_GrantMaintain(t *testing.T) {
+	testDB := testDB()
+	testUser := testUser()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	err = c.CreateUser(testUser, testPassword())
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	caps, err := c.Capabilities()
+	assert.NoError(t, err)
+
+	err = c.Grant("maintain", testDB, testUser)
+	if caps.MaintainPrivilege {
+		assert.NoError(t, err)
+		assert.NoError(t, c.Revoke("MAINTAIN", testDB, testUser))
+	} else {
+		assert.ErrorIs(t, err, ErrUnsupportedByServer)
+	}
+}
+
+func TestPostgresController_CreateDatabaseWithOptions(t *testing.T) {
+	c := createTestController()
+	defer c.Close()
+
+	caps, err := c.Capabilities()
+	assert.NoError(t, err)
+
+	libcDB := testDB()
+	err = c.CreateDatabaseWithOptions(libcDB, CreateDatabaseOptions{
+		Template:       "template0",
+		Encoding:       "UTF8",
+		LCCollate:      "C",
+		LCCtype:        "C",
+		LocaleProvider: "libc",
+	})
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(libcDB)
+
+	info, err := c.DescribeDatabase(libcDB)
+	assert.NoError(t, err)
+	assert.Equal(t, "UTF8", info.Encoding)
+	assert.Equal(t, "C", info.Collation)
+
+	err = c.CreateDatabaseWithOptions(libcDB, CreateDatabaseOptions{})
+	assert.Equal(t, ErrDBExists, err)
+
+	err = c.CreateDatabaseWithOptions(testDB(), CreateDatabaseOptions{LocaleProvider: "unknown"})
+	assert.Error(t, err)
+
+	icuDB := testDB()
+	err = c.CreateDatabaseWithOptions(icuDB, CreateDatabaseOptions{
+		Template:       "template0",
+		Encoding:       "UTF8",
+		LocaleProvider: "icu",
+		ProviderLocale: "und",
+	})
+	if caps.ICULocaleProvider {
+		assert.NoError(t, err)
+		defer c.DeleteDatabase(icuDB)
+
+		opts, err := c.databaseOptions(icuDB)
+		assert.NoError(t, err)
+		assert.Equal(t, "icu", opts.create.LocaleProvider)
+		assert.Equal(t, "und", opts.create.ProviderLocale)
+	} else {
+		assert.ErrorIs(t, err, ErrUnsupportedByServer)
+	}
+
+	builtinDB := testDB()
+	err = c.CreateDatabaseWithOptions(builtinDB, CreateDatabaseOptions{
+		Template:       "template0",
+		Encoding:       "UTF8",
+		LocaleProvider: "builtin",
+		ProviderLocale: "C",
+	})
+	if caps.BuiltinLocaleProvider {
+		assert.NoError(t, err)
+		defer c.DeleteDatabase(builtinDB)
+	} else {
+		assert.ErrorIs(t, err, ErrUnsupportedByServer)
+	}
+}
@@ -0,0 +1,575 @@
+// postgresctl/copy.go
+package postgresctl
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+type CopyStage string
+
+const (
+	CopyStageRoles    CopyStage = "roles"
+	CopyStageSchema   CopyStage = "schema"
+	CopyStageData     CopyStage = "data"
+	CopyStagePostData CopyStage = "post_data"
+	CopyStageGrants   CopyStage = "grants"
+	CopyStageDone     CopyStage = "done"
+)
+
+// Progress is reported after this many rows of a table
+const copyProgressRows = 10000
+
+var (
+	ErrRowCountMismatch = fmt.Errorf("row count mismatch")
+)
+
+type CopyOptions struct {
+	// Schemas limits the copy to these schemas, all user schemas by default
+	Schemas []string
+	// Progress is called whenever a stage starts, during table copies and
+	// once the copy is done
+	Progress func(CopyProgress)
+}
+
+type CopyProgress struct {
+	Stage CopyStage
+	// Set during CopyStageData
+	Schema     string
+	Table      string
+	Rows       int64
+	TablesDone int
+	Tables     int
+}
+
+type CopyReport struct {
+	// Roles created on the target server
+	Roles  []string
+	Tables []CopiedTable
+}
+
+type CopiedTable struct {
+	Schema string
+	Name   string
+	Rows   int64
+}
+
+type copyRole struct {
+	name       string
+	canLogin   bool
+	inherit    bool
+	createDB   bool
+	createRole bool
+	connLimit  int
+	password   sql.NullString
+	validUntil sql.NullString
+}
+
+type databaseOptions struct {
+	create    CreateDatabaseOptions
+	connLimit int
+	hasACL    bool
+	grants    []databaseGrant
+}
+
+type databaseGrant struct {
+	privilege string
+	// quoted role name or PUBLIC
+	grantee   string
+	grantable bool
+}
+
+// Roles referenced by the current database: its owner, grantees on the
+// database and owners and grantees of objects inside it. Predefined roles
+// exist on every server and are skipped.
+const referencedRolesQuery = `
+	WITH refs AS (
+		SELECT d.refobjid AS oid
+		FROM pg_shdepend d
+		WHERE d.dbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+		AND d.refclassid = 'pg_authid'::regclass
+		UNION
+		SELECT datdba FROM pg_database WHERE datname = current_database()
+		UNION
+		SELECT a.grantee
+		FROM pg_database, aclexplode(datacl) a
+		WHERE datname = current_database()
+	)
+	SELECT r.rolname
+	FROM pg_roles r
+	JOIN refs ON refs.oid = r.oid
+	WHERE r.rolname NOT LIKE 'pg\_%'
+	ORDER BY r.rolname
+`
+
+// Statements handing every object back to its owner, run on the target after
+// the data has been loaded
+var dumpOwnersQuery = `
+	SELECT format('ALTER SCHEMA %I OWNER TO %I;', n.nspname, pg_catalog.pg_get_userbyid(n.nspowner))
+	FROM pg_namespace n
+	WHERE ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_namespace", "n.oid") + `
+	UNION ALL
+	SELECT format('ALTER %s %I.%I OWNER TO %I;',
+		CASE c.relkind WHEN 'v' THEN 'VIEW' WHEN 'm' THEN 'MATERIALIZED VIEW' WHEN 'S' THEN 'SEQUENCE' ELSE 'TABLE' END,
+		n.nspname, c.relname, pg_catalog.pg_get_userbyid(c.relowner))
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('r', 'p', 'v', 'm', 'S')
+	AND ` + dumpSchemaFilter + `
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid
+		AND (d.deptype = 'e' OR (c.relkind = 'S' AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a', 'i')))
+	)
+	UNION ALL
+	SELECT format('ALTER ROUTINE %s OWNER TO %I;', p.oid::regprocedure, pg_catalog.pg_get_userbyid(p.proowner))
+	FROM pg_proc p
+	JOIN pg_namespace n ON n.oid = p.pronamespace
+	WHERE p.prokind IN ('f', 'p')
+	AND ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_proc", "p.oid") + `
+	UNION ALL
+	SELECT format('ALTER %s %I.%I OWNER TO %I;', CASE t.typtype WHEN 'd' THEN 'DOMAIN' ELSE 'TYPE' END,
+		n.nspname, t.typname, pg_catalog.pg_get_userbyid(t.typowner))
+	FROM pg_type t
+	JOIN pg_namespace n ON n.oid = t.typnamespace
+	WHERE t.typtype IN ('e', 'd')
+	AND ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_type", "t.oid") + `
+`
+
+// Grants on schemas, relations and routines. Objects with a NULL ACL still
+// have the default privileges, the others are reset to the owner's
+// privileges before the grants are replayed.
+var dumpGrantsQuery = `
+	WITH objects AS (
+		SELECT 'SCHEMA' AS keyword, format('%I', n.nspname) AS name, n.nspacl AS acl, n.nspowner AS owner
+		FROM pg_namespace n
+		WHERE n.nspacl IS NOT NULL
+		AND ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_namespace", "n.oid") + `
+		UNION ALL
+		SELECT CASE c.relkind WHEN 'S' THEN 'SEQUENCE' ELSE 'TABLE' END,
+			format('%I.%I', n.nspname, c.relname), c.relacl, c.relowner
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relacl IS NOT NULL
+		AND c.relkind IN ('r', 'p', 'v', 'm', 'S')
+		AND ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+		UNION ALL
+		SELECT CASE p.prokind WHEN 'p' THEN 'PROCEDURE' ELSE 'FUNCTION' END,
+			p.oid::regprocedure::text, p.proacl, p.proowner
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE p.proacl IS NOT NULL
+		AND p.prokind IN ('f', 'p')
+		AND ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_proc", "p.oid") + `
+	)
+	SELECT format('REVOKE ALL ON %s %s FROM PUBLIC;', o.keyword, o.name)
+	FROM objects o
+	UNION ALL
+	SELECT format('GRANT %s ON %s %s TO %s%s;', a.privilege_type, o.keyword, o.name,
+		CASE a.grantee WHEN 0 THEN 'PUBLIC' ELSE quote_ident(pg_catalog.pg_get_userbyid(a.grantee)) END,
+		CASE WHEN a.is_grantable THEN ' WITH GRANT OPTION' ELSE '' END)
+	FROM objects o, aclexplode(o.acl) a
+	WHERE a.grantee <> o.owner
+`
+
+// CopyDatabase copies srcDB on src to a new database dstDB on dst. Roles the
+// database refers to are created on dst with the same attributes and
+// password hashes unless they exist there already, superuser and
+// replication attributes are not copied. Memberships of the created roles
+// are granted again where the other role exists on dst. The schema is reconstructed like
+// ExportDatabase does, followed by ownership and grants, and table data is
+// streamed from a single snapshot. The target is dropped again if the copy
+// fails, created roles are kept.
+func CopyDatabase(ctx context.Context, src *PostgresController, srcDB string, dst *PostgresController, dstDB string, opts CopyOptions) (report CopyReport, err error) {
+	if err := validateDBName(srcDB); err != nil {
+		return CopyReport{}, err
+	}
+	if err := validateDBName(dstDB); err != nil {
+		return CopyReport{}, err
+	}
+
+	if err := dst.ensurePrimary(); err != nil {
+		return CopyReport{}, err
+	}
+
+	progress := func(p CopyProgress) {
+		if opts.Progress != nil {
+			opts.Progress(p)
+		}
+	}
+
+	if exists, err := src.DatabaseExists(srcDB); err != nil {
+		return CopyReport{}, err
+	} else if !exists {
+		return CopyReport{}, ErrDBDoesNotExist
+	}
+	if exists, err := dst.DatabaseExists(dstDB); err != nil {
+		return CopyReport{}, err
+	} else if exists {
+		return CopyReport{}, ErrDBExists
+	}
+
+	dbOpts, err := src.databaseOptions(srcDB)
+	if err != nil {
+		return CopyReport{}, err
+	}
+
+	srcConn, err := src.openDB(srcDB)
+	if err != nil {
+		return CopyReport{}, err
+	}
+	defer srcConn.Close()
+
+	tx, err := srcConn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return CopyReport{}, fmt.Errorf("error starting copy transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	progress(CopyProgress{Stage: CopyStageRoles})
+	roles, err := queryStrings(tx, referencedRolesQuery)
+	if err != nil {
+		return CopyReport{}, fmt.Errorf("error listing referenced roles: %w", err)
+	}
+	report.Roles, err = copyRoles(src, dst, roles)
+	if err != nil {
+		return report, err
+	}
+	if err := copyMemberships(src, dst, report.Roles); err != nil {
+		return report, err
+	}
+
+	progress(CopyProgress{Stage: CopyStageSchema})
+	dump, err := dumpSchema(tx, opts.Schemas)
+	if err != nil {
+		return report, err
+	}
+	privileges, err := dumpPrivileges(tx, opts.Schemas)
+	if err != nil {
+		return report, err
+	}
+
+	if err := dst.CreateDatabaseWithOptions(dstDB, dbOpts.create); err != nil {
+		return report, err
+	}
+	defer func() {
+		if err != nil {
+			_, dropErr := dst.db.Exec(`DROP DATABASE IF EXISTS "` + dstDB + `"`)
+			err = errors.Join(err, dropErr)
+		}
+	}()
+
+	if dbOpts.connLimit != -1 {
+		_, err := dst.db.Exec(fmt.Sprintf(`ALTER DATABASE "%s" CONNECTION LIMIT %d`, dstDB, dbOpts.connLimit))
+		if err != nil {
+			return report, fmt.Errorf("error setting connection limit: %w", err)
+		}
+	}
+
+	dstConn, err := dst.openDB(dstDB)
+	if err != nil {
+		return report, err
+	}
+	defer dstConn.Close()
+
+	if _, err := dstConn.ExecContext(ctx, joinStatements(dump.PreData)); err != nil {
+		return report, fmt.Errorf("error restoring schema: %w", err)
+	}
+
+	snapshot, err := src.openSnapshotConn(ctx, srcDB, tx)
+	if err != nil {
+		return report, err
+	}
+	defer snapshot.Close(ctx)
+
+	for i, t := range dump.Tables {
+		if len(t.Columns) == 0 {
+			continue
+		}
+
+		update := func(rows int64) {
+			progress(CopyProgress{Stage: CopyStageData, Schema: t.Schema, Table: t.Name, Rows: rows, TablesDone: i, Tables: len(dump.Tables)})
+		}
+		update(0)
+
+		rows, err := copyTableData(ctx, snapshot, dstConn, t, update)
+		if err != nil {
+			return report, fmt.Errorf("error copying %s.%s: %w", t.Schema, t.Name, err)
+		}
+
+		var loaded int64
+		err = dstConn.QueryRowContext(ctx, `SELECT count(*) FROM ONLY `+quoteIdent(t.Schema)+`.`+quoteIdent(t.Name)).Scan(&loaded)
+		if err != nil {
+			return report, fmt.Errorf("error counting rows of %s.%s: %w", t.Schema, t.Name, err)
+		}
+		if loaded != rows {
+			return report, fmt.Errorf("%w: %s.%s has %d rows on the target, copied %d", ErrRowCountMismatch, t.Schema, t.Name, loaded, rows)
+		}
+
+		report.Tables = append(report.Tables, CopiedTable{Schema: t.Schema, Name: t.Name, Rows: rows})
+	}
+
+	progress(CopyProgress{Stage: CopyStagePostData, TablesDone: len(dump.Tables), Tables: len(dump.Tables)})
+	if len(dump.PostData) > 0 {
+		if _, err := dstConn.ExecContext(ctx, joinStatements(dump.PostData)); err != nil {
+			return report, fmt.Errorf("error restoring constraints and indexes: %w", err)
+		}
+	}
+
+	progress(CopyProgress{Stage: CopyStageGrants, TablesDone: len(dump.Tables), Tables: len(dump.Tables)})
+	if len(privileges) > 0 {
+		if _, err := dstConn.ExecContext(ctx, joinStatements(privileges)); err != nil {
+			return report, fmt.Errorf("error restoring ownership and grants: %w", err)
+		}
+	}
+	for _, stmt := range dbOpts.grantStatements(dstDB) {
+		if _, err := dst.db.ExecContext(ctx, stmt); err != nil {
+			return report, fmt.Errorf("error restoring database grants: %w", err)
+		}
+	}
+
+	progress(CopyProgress{Stage: CopyStageDone, TablesDone: len(dump.Tables), Tables: len(dump.Tables)})
+	return report, nil
+}
+
+func (c *PostgresController) databaseOptions(dbName string) (databaseOptions, error) {
+	caps, err := c.Capabilities()
+	if err != nil {
+		return databaseOptions{}, err
+	}
+
+	// The provider's locale moved from daticulocale to datlocale in 17
+	provider := `'libc', ''`
+	switch {
+	case caps.BuiltinLocaleProvider:
+		provider = `CASE datlocprovider WHEN 'i' THEN 'icu' WHEN 'b' THEN 'builtin' ELSE 'libc' END, COALESCE(datlocale, '')`
+	case caps.ICULocaleProvider:
+		provider = `CASE datlocprovider WHEN 'i' THEN 'icu' ELSE 'libc' END, COALESCE(daticulocale, '')`
+	}
+
+	opts := databaseOptions{create: CreateDatabaseOptions{Template: "template0"}}
+	err = c.db.QueryRow(`
+		SELECT pg_catalog.pg_encoding_to_char(encoding), datcollate, datctype,
+			pg_catalog.pg_get_userbyid(datdba), datconnlimit, datacl IS NOT NULL, `+provider+`
+		FROM pg_database
+		WHERE datname = $1
+	`, dbName).Scan(&opts.create.Encoding, &opts.create.LCCollate, &opts.create.LCCtype, &opts.create.Owner,
+		&opts.connLimit, &opts.hasACL, &opts.create.LocaleProvider, &opts.create.ProviderLocale)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return databaseOptions{}, ErrDBDoesNotExist
+		}
+		return databaseOptions{}, fmt.Errorf("error getting database options: %w", err)
+	}
+
+	rows, err := c.db.Query(`
+		SELECT a.privilege_type,
+			CASE a.grantee WHEN 0 THEN 'PUBLIC' ELSE quote_ident(pg_catalog.pg_get_userbyid(a.grantee)) END,
+			a.is_grantable
+		FROM pg_database d, aclexplode(d.datacl) a
+		WHERE d.datname = $1 AND a.grantee <> d.datdba
+	`, dbName)
+	if err != nil {
+		return databaseOptions{}, fmt.Errorf("error getting database grants: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g databaseGrant
+		if err := rows.Scan(&g.privilege, &g.grantee, &g.grantable); err != nil {
+			return databaseOptions{}, fmt.Errorf("error scanning database grant: %w", err)
+		}
+		opts.grants = append(opts.grants, g)
+	}
+
+	return opts, rows.Err()
+}
+
+// grantStatements resets dbName to the owner's privileges and replays the
+// grants, like dumpGrantsQuery does for objects inside the database.
+func (opts databaseOptions) grantStatements(dbName string) []string {
+	if !opts.hasACL {
+		return nil
+	}
+
+	stmts := []string{`REVOKE ALL ON DATABASE "` + dbName + `" FROM PUBLIC`}
+	for _, g := range opts.grants {
+		stmt := `GRANT ` + g.privilege + ` ON DATABASE "` + dbName + `" TO ` + g.grantee
+		if g.grantable {
+			stmt += ` WITH GRANT OPTION`
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+// copyRoles creates the roles missing on dst and returns their names.
+func copyRoles(src, dst *PostgresController, names []string) ([]string, error) {
+	var created []string
+	for _, name := range names {
+		var exists bool
+		err := dst.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM pg_roles WHERE rolname = $1)`, name).Scan(&exists)
+		if err != nil {
+			return created, fmt.Errorf("error checking if role %s exists: %w", name, err)
+		}
+		if exists {
+			continue
+		}
+
+		var r copyRole
+		// Password hashes are only readable from pg_authid
+		err = src.db.QueryRow(`
+			SELECT rolname, rolcanlogin, rolinherit, rolcreatedb, rolcreaterole, rolconnlimit,
+				rolpassword, rolvaliduntil::text
+			FROM pg_authid
+			WHERE rolname = $1
+		`, name).Scan(&r.name, &r.canLogin, &r.inherit, &r.createDB, &r.createRole, &r.connLimit, &r.password, &r.validUntil)
+		if err != nil {
+			return created, fmt.Errorf("error reading role %s: %w", name, err)
+		}
+
+		if _, err := dst.db.Exec(r.createSQL()); err != nil {
+			return created, fmt.Errorf("error creating role %s: %w", name, err)
+		}
+		created = append(created, name)
+	}
+
+	return created, nil
+}
+
+// Memberships in which either side is one of the given roles
+const copyMembershipsQuery = `
+	SELECT r.rolname, m.rolname, am.admin_option
+	FROM pg_auth_members am
+	JOIN pg_roles r ON r.oid = am.roleid
+	JOIN pg_roles m ON m.oid = am.member
+	WHERE r.rolname = ANY($1) OR m.rolname = ANY($1)
+	ORDER BY 1, 2
+`
+
+// copyMemberships grants the memberships the created roles have on src on dst
+// too. Memberships with a role that doesn't exist on dst are skipped.
+func copyMemberships(src, dst *PostgresController, created []string) error {
+	if len(created) == 0 {
+		return nil
+	}
+
+	rows, err := src.db.Query(copyMembershipsQuery, pq.Array(created))
+	if err != nil {
+		return fmt.Errorf("error listing role memberships: %w", err)
+	}
+	defer rows.Close()
+
+	type membership struct {
+		role, member string
+		admin        bool
+	}
+	var memberships []membership
+	for rows.Next() {
+		var m membership
+		if err := rows.Scan(&m.role, &m.member, &m.admin); err != nil {
+			return fmt.Errorf("error scanning role membership: %w", err)
+		}
+		memberships = append(memberships, m)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range memberships {
+		roleExists, err := dst.roleExists(m.role)
+		if err != nil {
+			return err
+		}
+		memberExists, err := dst.roleExists(m.member)
+		if err != nil {
+			return err
+		}
+		if !roleExists || !memberExists {
+			continue
+		}
+
+		stmt := "GRANT " + quoteIdent(m.role) + " TO " + quoteIdent(m.member)
+		if m.admin {
+			stmt += " WITH ADMIN OPTION"
+		}
+		if _, err := dst.db.Exec(stmt); err != nil {
+			return fmt.Errorf("error granting %s to %s: %w", m.role, m.member, err)
+		}
+	}
+
+	return nil
+}
+
+func (r copyRole) createSQL() string {
+	attrs := []string{
+		map[bool]string{true: "LOGIN", false: "NOLOGIN"}[r.canLogin],
+		map[bool]string{true: "INHERIT", false: "NOINHERIT"}[r.inherit],
+		map[bool]string{true: "CREATEDB", false: "NOCREATEDB"}[r.createDB],
+		map[bool]string{true: "CREATEROLE", false: "NOCREATEROLE"}[r.createRole],
+		fmt.Sprintf("CONNECTION LIMIT %d", r.connLimit),
+	}
+	// Hashed passwords are stored as they are
+	if r.password.Valid {
+		attrs = append(attrs, "PASSWORD "+quoteLiteral(r.password.String))
+	}
+	if r.validUntil.Valid {
+		attrs = append(attrs, "VALID UNTIL "+quoteLiteral(r.validUntil.String))
+	}
+	return "CREATE ROLE " + quoteIdent(r.name) + " WITH " + strings.Join(attrs, " ")
+}
+
+// dumpPrivileges returns statements restoring ownership and grants of the
+// objects dumpSchema covers.
+func dumpPrivileges(q queryer, schemas []string) ([]string, error) {
+	filter := pq.Array(schemas)
+
+	owners, err := queryStrings(q, dumpOwnersQuery, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error dumping owners: %w", err)
+	}
+	grants, err := queryStrings(q, dumpGrantsQuery, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error dumping grants: %w", err)
+	}
+
+	return append(owners, grants...), nil
+}
+
+// copyTableData streams t from the source snapshot into the same table on
+// dst, through the same CSV that ExportDatabase writes.
+func copyTableData(ctx context.Context, src *pgconn.PgConn, dst *sql.DB, t dumpTable, update func(rows int64)) (int64, error) {
+	pr, pw := io.Pipe()
+	copied := make(chan error, 1)
+	var rows int64
+	go func() {
+		var err error
+		rows, err = copyTableOut(ctx, src, t, pw, update)
+		pw.CloseWithError(err)
+		copied <- err
+	}()
+
+	loaded, err := importTableData(ctx, dst, exportTable{Schema: t.Schema, Name: t.Name, Columns: t.Columns}, pr)
+	// Unblock the source if loading stopped early, the source then fails
+	// too and the load error is the one to report
+	pr.CloseWithError(err)
+	if srcErr := <-copied; srcErr != nil && (err == nil || errors.Is(err, srcErr)) {
+		return 0, srcErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if loaded != rows {
+		return loaded, fmt.Errorf("%w: loaded %d rows, read %d", ErrRowCountMismatch, loaded, rows)
+	}
+
+	update(rows)
+	return rows, nil
+}
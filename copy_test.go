@@ -0,0 +1,148 @@
+// postgresctl/copy_test.go
+package postgresctl
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyRole_CreateSQL(t *testing.T) {
+	r := copyRole{
+		name:      `app"user`,
+		canLogin:  true,
+		inherit:   true,
+		connLimit: 5,
+		password:  sql.NullString{String: "SCRAM-SHA-256$4096:salt$key:server", Valid: true},
+	}
+	assert.Equal(t,
+		`CREATE ROLE "app""user" WITH LOGIN INHERIT NOCREATEDB NOCREATEROLE CONNECTION LIMIT 5 PASSWORD 'SCRAM-SHA-256$4096:salt$key:server'`,
+		r.createSQL())
+
+	r = copyRole{name: "readers", connLimit: -1, validUntil: sql.NullString{String: "2030-01-01 00:00:00+00", Valid: true}}
+	assert.Equal(t,
+		`CREATE ROLE "readers" WITH NOLOGIN NOINHERIT NOCREATEDB NOCREATEROLE CONNECTION LIMIT -1 VALID UNTIL '2030-01-01 00:00:00+00'`,
+		r.createSQL())
+}
+
+func TestCopyDatabase(t *testing.T) {
+	srcDB := testDB()
+	dstDB := testDB()
+	testUser := testUser()
+	testPassword := testPassword()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateUser(testUser, testPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUserWithOptions(testUser, DeleteUserOptions{DropOwned: true})
+
+	err = c.CreateDatabase(srcDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(srcDB)
+
+	err = c.Grant("CONNECT", srcDB, testUser)
+	assert.NoError(t, err)
+
+	db, err := c.openDB(srcDB)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE SCHEMA app;
+		CREATE TABLE app.items (id serial PRIMARY KEY, name text, price numeric);
+		CREATE TABLE app.orders (id bigint GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY, item_id int REFERENCES app.items (id));
+		INSERT INTO app.items (name, price) SELECT 'item ' || i, i * 1.5 FROM generate_series(1, 25000) i;
+		INSERT INTO app.orders (item_id) SELECT id FROM app.items WHERE id % 10 = 0;
+		ALTER TABLE app.orders OWNER TO "` + testUser + `";
+		GRANT USAGE ON SCHEMA app TO "` + testUser + `";
+		GRANT SELECT ON app.items TO "` + testUser + `";
+	`)
+	assert.NoError(t, err)
+
+	var stages []CopyStage
+	var itemProgress []int64
+	report, err := CopyDatabase(context.Background(), c, srcDB, c, dstDB, CopyOptions{
+		Progress: func(p CopyProgress) {
+			if len(stages) == 0 || stages[len(stages)-1] != p.Stage {
+				stages = append(stages, p.Stage)
+			}
+			if p.Stage == CopyStageData && p.Table == "items" {
+				itemProgress = append(itemProgress, p.Rows)
+			}
+		},
+	})
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(dstDB)
+
+	assert.Equal(t, []CopyStage{CopyStageRoles, CopyStageSchema, CopyStageData, CopyStagePostData, CopyStageGrants, CopyStageDone}, stages)
+	assert.Equal(t, []int64{0, 10000, 20000, 25000}, itemProgress)
+	assert.Empty(t, report.Roles, "roles exist on the same server")
+	assert.ElementsMatch(t, []CopiedTable{
+		{Schema: "app", Name: "items", Rows: 25000},
+		{Schema: "app", Name: "orders", Rows: 2500},
+	}, report.Tables)
+
+	_, err = CopyDatabase(context.Background(), c, srcDB, c, dstDB, CopyOptions{})
+	assert.Equal(t, ErrDBExists, err)
+
+	// The copied user can connect and read what it was granted
+	userConn := pc
+	userConn.Username = testUser
+	userConn.Password = testPassword
+	userConn.Database = dstDB
+	userDB, err := sql.Open("postgres", userConn.connStr())
+	assert.NoError(t, err)
+	defer userDB.Close()
+
+	var total float64
+	err = userDB.QueryRow(`SELECT sum(price) FROM app.items`).Scan(&total)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5*25000*25001/2, total)
+
+	var orders int
+	err = userDB.QueryRow(`SELECT count(*) FROM app.orders`).Scan(&orders)
+	assert.NoError(t, err, "owner should have access to its table")
+	assert.Equal(t, 2500, orders)
+
+	var nextItem int
+	err = userDB.QueryRow(`SELECT nextval('app.items_id_seq')`).Scan(&nextItem)
+	assert.Error(t, err, "no grant on the sequence")
+
+	dst, err := c.openDB(dstDB)
+	assert.NoError(t, err)
+	defer dst.Close()
+
+	err = dst.QueryRow(`INSERT INTO app.items (name) VALUES ('new') RETURNING id`).Scan(&nextItem)
+	assert.NoError(t, err)
+	assert.Equal(t, 25001, nextItem)
+}
+
+func TestCopyDatabase_Cancelled(t *testing.T) {
+	srcDB := testDB()
+	dstDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateDatabase(srcDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(srcDB)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = CopyDatabase(ctx, c, srcDB, c, dstDB, CopyOptions{
+		Progress: func(p CopyProgress) {
+			if p.Stage == CopyStageSchema {
+				cancel()
+			}
+		},
+	})
+	assert.Error(t, err)
+
+	exists, err := c.DatabaseExists(dstDB)
+	assert.NoError(t, err)
+	assert.False(t, exists, "target should be dropped")
+}
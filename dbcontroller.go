@@ -3,21 +3,33 @@ package postgresctl
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 
 	_ "github.com/lib/pq"
 )
 
 type DBController interface {
 	CreateDatabase(dbName string) error
+	CreateDatabaseWithOptions(dbName string, opts CreateDatabaseOptions) error
 	DeleteDatabase(dbName string) error
 	ListDatabases() ([]string, error)
 	DatabaseExists(dbName string) (bool, error)
-	Size(dbName string) (int, error)
+	Size(dbName string) (int64, error)
+	SizeBreakdown(dbName string, topN int) (SizeBreakdown, error)
 	Tables(dbName string) ([]string, error)
 	TransferDatabaseOwnership(dbName, newOwner string) error
 	TransferPublicSchemaOwnership(dbName, newOwner string) error
+	RenameDatabase(oldName, newName string) error
+	CloneDatabase(srcName, dstName string, opts CloneOptions) error
+	DescribeDatabases(opts DescribeDatabasesOptions) ([]DatabaseInfo, error)
+	DescribeDatabase(dbName string) (DatabaseInfo, error)
+	DescribeTables(dbName string, opts DescribeTablesOptions) ([]TableInfo, error)
+	SetDatabaseReadOnly(dbName string, readOnly, terminateSessions bool) error
+	DatabaseReadOnly(dbName string) (bool, error)
+	TransferAllOwnership(dbName, fromRole, toRole string) (OwnershipReport, error)
 }
 
 var _ DBController = &PostgresController{}
@@ -29,9 +41,38 @@ var (
 	ErrDBDoesNotExist = fmt.Errorf("database does not exist")
 )
 
+type CreateDatabaseOptions struct {
+	Owner string
+	// Template defaults to template1, a different encoding or locale
+	// requires template0
+	Template  string
+	Encoding  string
+	LCCollate string
+	LCCtype   string
+	// LocaleProvider is "libc", "icu" (PostgreSQL 15+) or "builtin" (17+)
+	LocaleProvider string
+	// ProviderLocale is the locale of the icu or builtin provider
+	ProviderLocale string
+}
+
+type CloneOptions struct {
+	// Owner, if set, becomes the owner of the clone database and its public
+	// schema. Tables and other objects copied from the source keep their
+	// owners, see TransferAllOwnership to hand those over as well.
+	Owner string
+}
+
 type PostgresController struct {
 	db *sql.DB
 	pc PostgresConn
+
+	// mu serializes entering and leaving maintenance
+	mu sync.Mutex
+
+	capsMu sync.Mutex
+	caps   *Capabilities
+
+	archiveOnDelete bool
 }
 
 type PostgresConn struct {
@@ -41,6 +82,9 @@ type PostgresConn struct {
 	Port     int
 	Database string
 	SSLMode  string
+	// Hosts are further "host" or "host:port" candidates. When set, the
+	// controller connects to the first of Host and Hosts that is a primary.
+	Hosts []string
 }
 
 // connStr returns the connection string from the postgressConn struct
@@ -52,6 +96,18 @@ func (pc PostgresConn) connStr() string {
 		pc.Username, pc.Password, pc.Host, pc.Port, pc.Database, pc.SSLMode)
 }
 
+// openDB opens a separate connection pool to dbName using the controller's credentials
+func (c *PostgresController) openDB(dbName string) (*sql.DB, error) {
+	perDbConn := c.pc
+	perDbConn.Database = dbName
+
+	db, err := sql.Open("postgres", perDbConn.connStr())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database %s: %w", dbName, err)
+	}
+	return db, nil
+}
+
 type Option func(*PostgresController)
 
 func WithBadUsernames(usernames []string) Option {
@@ -60,13 +116,30 @@ func WithBadUsernames(usernames []string) Option {
 	}
 }
 
+// WithArchiveOnDelete makes DeleteDatabase archive databases instead of
+// dropping them, see ArchiveDatabase.
+func WithArchiveOnDelete() Option {
+	return func(c *PostgresController) {
+		c.archiveOnDelete = true
+	}
+}
+
 func NewPostgresController(conn PostgresConn, opts ...Option) (*PostgresController, error) {
-	// build connection string
-	connStr := conn.connStr()
-	// create database connection
-	db, err := sql.Open("postgres", connStr)
-	if err != nil {
-		return nil, fmt.Errorf("error creating database connection: %s", err)
+	var db *sql.DB
+	var err error
+	if len(conn.Hosts) > 0 {
+		conn, db, err = connectPrimary(conn)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// build connection string
+		connStr := conn.connStr()
+		// create database connection
+		db, err = sql.Open("postgres", connStr)
+		if err != nil {
+			return nil, fmt.Errorf("error creating database connection: %s", err)
+		}
 	}
 
 	c := &PostgresController{db: db, pc: conn}
@@ -75,6 +148,12 @@ func NewPostgresController(conn PostgresConn, opts ...Option) (*PostgresControll
 		opt(c)
 	}
 
+	// An unsupported server fails here rather than in some later call
+	if err := c.checkServerVersion(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return c, nil
 }
 
@@ -88,6 +167,10 @@ func (c *PostgresController) CreateDatabase(dbName string) error {
 		return err
 	}
 
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
 	_, err = c.db.Exec(fmt.Sprintf("CREATE DATABASE \"%s\"", dbName))
 	if err != nil {
 		if strings.Contains(err.Error(), "already exists") {
@@ -97,23 +180,101 @@ func (c *PostgresController) CreateDatabase(dbName string) error {
 	return err
 }
 
+func (c *PostgresController) CreateDatabaseWithOptions(dbName string, opts CreateDatabaseOptions) error {
+	if err := validateDBName(dbName); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	caps, err := c.Capabilities()
+	if err != nil {
+		return err
+	}
+
+	query := `CREATE DATABASE "` + dbName + `"`
+	if opts.Owner != "" {
+		query += ` OWNER ` + quoteIdent(opts.Owner)
+	}
+	if opts.Template != "" {
+		query += ` TEMPLATE ` + quoteIdent(opts.Template)
+	}
+	if opts.Encoding != "" {
+		query += ` ENCODING ` + quoteLiteral(opts.Encoding)
+	}
+	if opts.LCCollate != "" {
+		query += ` LC_COLLATE ` + quoteLiteral(opts.LCCollate)
+	}
+	if opts.LCCtype != "" {
+		query += ` LC_CTYPE ` + quoteLiteral(opts.LCCtype)
+	}
+
+	switch opts.LocaleProvider {
+	case "":
+	case "libc":
+		// libc is the only provider before 15 and can't be named there
+		if caps.ICULocaleProvider {
+			query += ` LOCALE_PROVIDER libc`
+		}
+	case "icu":
+		if !caps.ICULocaleProvider {
+			return fmt.Errorf("%w: the icu locale provider requires PostgreSQL 15, server is %s", ErrUnsupportedByServer, caps.Version)
+		}
+		query += ` LOCALE_PROVIDER icu ICU_LOCALE ` + quoteLiteral(opts.ProviderLocale)
+	case "builtin":
+		if !caps.BuiltinLocaleProvider {
+			return fmt.Errorf("%w: the builtin locale provider requires PostgreSQL 17, server is %s", ErrUnsupportedByServer, caps.Version)
+		}
+		query += ` LOCALE_PROVIDER builtin BUILTIN_LOCALE ` + quoteLiteral(opts.ProviderLocale)
+	default:
+		return fmt.Errorf("unknown locale provider %q", opts.LocaleProvider)
+	}
+
+	_, err = c.db.Exec(query)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return ErrDBExists
+		}
+		return fmt.Errorf("error creating database: %w", err)
+	}
+	return nil
+}
+
 func (c *PostgresController) DeleteDatabase(dbName string) error {
 	err := validateDBName(dbName)
 	if err != nil {
 		return err
 	}
 
-	// First, disconnect all users from the database
-	_, err = c.db.Exec(fmt.Sprintf(`
-		SELECT pg_terminate_backend(pg_stat_activity.pid)
-		FROM pg_stat_activity
-		WHERE pg_stat_activity.datname = '%s'
-		AND pid <> pg_backend_pid()`, dbName))
+	if c.archiveOnDelete && !isArchivedDatabaseName(dbName) {
+		_, err = c.ArchiveDatabase(dbName, "")
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	caps, err := c.Capabilities()
 	if err != nil {
-		return fmt.Errorf("error terminating connections: %w", err)
+		return err
+	}
+
+	drop := fmt.Sprintf("DROP DATABASE \"%s\"", dbName)
+	if caps.DropDatabaseForce {
+		// Terminates sessions without leaving a window for new ones
+		drop += " WITH (FORCE)"
+	} else {
+		// First, disconnect all users from the database
+		err = c.terminateDatabaseConnections(dbName)
+		if err != nil {
+			return err
+		}
 	}
 
-	_, err = c.db.Exec(fmt.Sprintf("DROP DATABASE \"%s\"", dbName))
+	_, err = c.db.Exec(drop)
 	if err != nil {
 		if strings.Contains(err.Error(), "does not exist") {
 			return ErrDBDoesNotExist
@@ -124,6 +285,170 @@ func (c *PostgresController) DeleteDatabase(dbName string) error {
 	return err
 }
 
+func (c *PostgresController) RenameDatabase(oldName, newName string) error {
+	if err := validateDBName(oldName); err != nil {
+		return err
+	}
+	if err := validateDBName(newName); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	return c.renameDatabase(oldName, newName)
+}
+
+// renameDatabase renames a validated database on the primary
+func (c *PostgresController) renameDatabase(oldName, newName string) error {
+	// A database cannot be renamed while anyone is connected to it
+	err := c.terminateDatabaseConnections(oldName)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db.Exec(fmt.Sprintf("ALTER DATABASE \"%s\" RENAME TO \"%s\"", oldName, newName))
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return ErrDBExists
+		}
+		if strings.Contains(err.Error(), "does not exist") {
+			return ErrDBDoesNotExist
+		}
+		return fmt.Errorf("error renaming database: %w", err)
+	}
+
+	return nil
+}
+
+// CloneDatabase creates dstName using srcName as a template. PostgreSQL
+// requires the template to have no other sessions, so connections to the
+// source are blocked and terminated for the duration of the copy.
+func (c *PostgresController) CloneDatabase(srcName, dstName string, opts CloneOptions) (err error) {
+	if err := validateDBName(srcName); err != nil {
+		return err
+	}
+	if err := validateDBName(dstName); err != nil {
+		return err
+	}
+	if opts.Owner != "" {
+		if err := validateUsername(opts.Owner); err != nil {
+			return err
+		}
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	allowConn, err := c.databaseAllowsConnections(srcName)
+	if err != nil {
+		return err
+	}
+
+	if allowConn {
+		err = c.setAllowConnections(srcName, false)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if restoreErr := c.setAllowConnections(srcName, true); restoreErr != nil {
+				err = errors.Join(err, restoreErr)
+			}
+		}()
+	}
+
+	err = c.terminateDatabaseConnections(srcName)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db.Exec(fmt.Sprintf("CREATE DATABASE \"%s\" TEMPLATE \"%s\"", dstName, srcName))
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return ErrDBExists
+		}
+		return fmt.Errorf("error cloning database: %w", err)
+	}
+
+	if opts.Owner != "" {
+		err = c.transferDatabaseOwnership(dstName, opts.Owner)
+		if err != nil {
+			return fmt.Errorf("error transferring clone ownership: %w", err)
+		}
+		err = c.transferPublicSchemaOwnership(dstName, opts.Owner)
+		if err != nil {
+			return fmt.Errorf("error transferring clone schema ownership: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *PostgresController) databaseAllowsConnections(dbName string) (bool, error) {
+	var allowConn bool
+	err := c.db.QueryRow(`
+		SELECT datallowconn FROM pg_database
+		WHERE datname = $1
+	`, dbName).Scan(&allowConn)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, ErrDBDoesNotExist
+		}
+		return false, fmt.Errorf("error checking database connections: %w", err)
+	}
+	return allowConn, nil
+}
+
+func (c *PostgresController) setAllowConnections(dbName string, allow bool) error {
+	_, err := c.db.Exec(fmt.Sprintf("ALTER DATABASE \"%s\" WITH ALLOW_CONNECTIONS %t", dbName, allow))
+	if err != nil {
+		return fmt.Errorf("error setting ALLOW_CONNECTIONS: %w", err)
+	}
+	return nil
+}
+
+// SetDatabaseReadOnly toggles default_transaction_read_only for dbName. The
+// setting only applies to new sessions, terminateSessions kicks existing ones
+// so the change takes effect immediately.
+func (c *PostgresController) SetDatabaseReadOnly(dbName string, readOnly, terminateSessions bool) error {
+	var err error
+	if readOnly {
+		err = c.SetDatabaseSetting(dbName, "default_transaction_read_only", "on")
+	} else {
+		err = c.ResetDatabaseSetting(dbName, "default_transaction_read_only")
+	}
+	if err != nil {
+		return err
+	}
+
+	if terminateSessions {
+		return c.terminateDatabaseConnections(dbName)
+	}
+	return nil
+}
+
+func (c *PostgresController) DatabaseReadOnly(dbName string) (bool, error) {
+	settings, err := c.GetDatabaseSettings(dbName)
+	if err != nil {
+		return false, err
+	}
+	return settingEnabled(settings["default_transaction_read_only"]), nil
+}
+
+func (c *PostgresController) terminateDatabaseConnections(dbName string) error {
+	_, err := c.db.Exec(`
+		SELECT pg_terminate_backend(pg_stat_activity.pid)
+		FROM pg_stat_activity
+		WHERE pg_stat_activity.datname = $1
+		AND pid <> pg_backend_pid()`, dbName)
+	if err != nil {
+		return fmt.Errorf("error terminating connections: %w", err)
+	}
+	return nil
+}
+
 func (c *PostgresController) ListDatabases() ([]string, error) {
 	rows, err := c.db.Query(`
 		SELECT datname FROM pg_database
@@ -144,7 +469,7 @@ func (c *PostgresController) ListDatabases() ([]string, error) {
 		databases = append(databases, database)
 	}
 
-	return filterBaseDatabases(databases), nil
+	return filterArchivedDatabases(filterBaseDatabases(databases)), nil
 }
 
 func (c *PostgresController) DatabaseExists(dbName string) (bool, error) {
@@ -166,13 +491,13 @@ func (c *PostgresController) DatabaseExists(dbName string) (bool, error) {
 	return exists, nil
 }
 
-func (c *PostgresController) Size(dbName string) (int, error) {
+func (c *PostgresController) Size(dbName string) (int64, error) {
 	err := validateDBName(dbName)
 	if err != nil {
 		return 0, err
 	}
 
-	var size int
+	var size int64
 	err = c.db.QueryRow(`
 		SELECT pg_database_size($1)
 	`, dbName).Scan(&size)
@@ -189,13 +514,9 @@ func (c *PostgresController) Tables(dbName string) ([]string, error) {
 		return nil, err
 	}
 
-	perDbConn := c.pc
-	perDbConn.Database = dbName
-	newConnStr := perDbConn.connStr()
-
-	db, err := sql.Open("postgres", newConnStr)
+	db, err := c.openDB(dbName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database %s: %w", dbName, err)
+		return nil, err
 	}
 	defer db.Close()
 
@@ -223,16 +544,30 @@ func (c *PostgresController) Tables(dbName string) ([]string, error) {
 }
 
 func (c *PostgresController) TransferDatabaseOwnership(dbName, newOwner string) error {
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	return c.transferDatabaseOwnership(dbName, newOwner)
+}
+
+func (c *PostgresController) transferDatabaseOwnership(dbName, newOwner string) error {
 	_, err := c.db.Exec(`ALTER DATABASE "` + dbName + `" OWNER TO "` + newOwner + `"`)
 	return err
 }
 
 func (c *PostgresController) TransferPublicSchemaOwnership(dbName, newOwner string) error {
-	perDbConn := c.pc
-	perDbConn.Database = dbName
-	db, err := sql.Open("postgres", perDbConn.connStr())
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	return c.transferPublicSchemaOwnership(dbName, newOwner)
+}
+
+func (c *PostgresController) transferPublicSchemaOwnership(dbName, newOwner string) error {
+	db, err := c.openDB(dbName)
 	if err != nil {
-		return fmt.Errorf("failed to connect to %s: %w", dbName, err)
+		return err
 	}
 	defer db.Close()
 
@@ -268,3 +603,11 @@ func validateDBName(dbName string) error {
 	}
 	return nil
 }
+
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
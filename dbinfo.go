@@ -0,0 +1,328 @@
+// postgresctl/dbinfo.go
+package postgresctl
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type DatabaseSortField string
+
+const (
+	SortDatabasesByName     DatabaseSortField = "name"
+	SortDatabasesBySize     DatabaseSortField = "size"
+	SortDatabasesBySessions DatabaseSortField = "sessions"
+)
+
+type DatabaseInfo struct {
+	Name             string
+	Owner            string
+	Encoding         string
+	Collation        string
+	CType            string
+	Size             int64
+	ConnectionLimit  int
+	AllowConnections bool
+	IsTemplate       bool
+	Tablespace       string
+	Comment          string
+	// ActiveSessions counts client sessions that are not idle
+	ActiveSessions int
+	ACL            []string
+}
+
+type DescribeDatabasesOptions struct {
+	IncludeTemplates     bool
+	IncludeBaseDatabases bool
+	IncludeArchived      bool
+	// Owner limits the result to databases owned by this role
+	Owner string
+	// NamePattern is a LIKE pattern matched against database names
+	NamePattern string
+	SortBy      DatabaseSortField
+	Descending  bool
+}
+
+const describeDatabasesQuery = `
+	SELECT d.datname,
+		pg_catalog.pg_get_userbyid(d.datdba),
+		pg_catalog.pg_encoding_to_char(d.encoding),
+		COALESCE(d.datcollate, ''),
+		COALESCE(d.datctype, ''),
+		pg_catalog.pg_database_size(d.oid),
+		d.datconnlimit,
+		d.datallowconn,
+		d.datistemplate,
+		t.spcname,
+		COALESCE(pg_catalog.shobj_description(d.oid, 'pg_database'), ''),
+		(SELECT count(*) FROM pg_stat_activity a WHERE a.datid = d.oid AND a.state <> 'idle'),
+		COALESCE(d.datacl::text[], '{}')
+	FROM pg_database d
+	JOIN pg_tablespace t ON t.oid = d.dattablespace
+`
+
+func (c *PostgresController) DescribeDatabases(opts DescribeDatabasesOptions) ([]DatabaseInfo, error) {
+	var conds []string
+	var args []any
+	if !opts.IncludeTemplates {
+		conds = append(conds, "d.datistemplate = false")
+	}
+	if opts.Owner != "" {
+		args = append(args, opts.Owner)
+		conds = append(conds, fmt.Sprintf("pg_catalog.pg_get_userbyid(d.datdba) = $%d", len(args)))
+	}
+	if opts.NamePattern != "" {
+		args = append(args, opts.NamePattern)
+		conds = append(conds, fmt.Sprintf("d.datname LIKE $%d", len(args)))
+	}
+
+	query := describeDatabasesQuery
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	infos, err := c.describeDatabases(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []DatabaseInfo
+	for _, info := range infos {
+		if !opts.IncludeBaseDatabases && contains(baseDBs, info.Name) {
+			continue
+		}
+		if !opts.IncludeArchived && isArchivedDatabaseName(info.Name) {
+			continue
+		}
+		filtered = append(filtered, info)
+	}
+	infos = filtered
+
+	err = sortDatabaseInfos(infos, opts.SortBy, opts.Descending)
+	if err != nil {
+		return nil, err
+	}
+
+	return infos, nil
+}
+
+func (c *PostgresController) DescribeDatabase(dbName string) (DatabaseInfo, error) {
+	err := validateDBName(dbName)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+
+	infos, err := c.describeDatabases(describeDatabasesQuery+" WHERE d.datname = $1", dbName)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	if len(infos) == 0 {
+		return DatabaseInfo{}, ErrDBDoesNotExist
+	}
+
+	return infos[0], nil
+}
+
+func (c *PostgresController) describeDatabases(query string, args ...any) ([]DatabaseInfo, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error describing databases: %w", err)
+	}
+	defer rows.Close()
+
+	var infos []DatabaseInfo
+	for rows.Next() {
+		var info DatabaseInfo
+		err = rows.Scan(
+			&info.Name,
+			&info.Owner,
+			&info.Encoding,
+			&info.Collation,
+			&info.CType,
+			&info.Size,
+			&info.ConnectionLimit,
+			&info.AllowConnections,
+			&info.IsTemplate,
+			&info.Tablespace,
+			&info.Comment,
+			&info.ActiveSessions,
+			pq.Array(&info.ACL),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning database: %w", err)
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, rows.Err()
+}
+
+func sortDatabaseInfos(infos []DatabaseInfo, by DatabaseSortField, desc bool) error {
+	var less func(a, b DatabaseInfo) bool
+	switch by {
+	case "", SortDatabasesByName:
+		less = func(a, b DatabaseInfo) bool { return a.Name < b.Name }
+	case SortDatabasesBySize:
+		less = func(a, b DatabaseInfo) bool { return a.Size < b.Size }
+	case SortDatabasesBySessions:
+		less = func(a, b DatabaseInfo) bool { return a.ActiveSessions < b.ActiveSessions }
+	default:
+		return fmt.Errorf("unknown sort field %q", by)
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		if desc {
+			return less(infos[j], infos[i])
+		}
+		return less(infos[i], infos[j])
+	})
+	return nil
+}
+
+type TableKind string
+
+const (
+	TableKindTable            TableKind = "table"
+	TableKindPartitionedTable TableKind = "partitioned table"
+	TableKindView             TableKind = "view"
+	TableKindMaterializedView TableKind = "materialized view"
+	TableKindForeignTable     TableKind = "foreign table"
+)
+
+var tableKindCodes = map[TableKind]string{
+	TableKindTable:            "r",
+	TableKindPartitionedTable: "p",
+	TableKindView:             "v",
+	TableKindMaterializedView: "m",
+	TableKindForeignTable:     "f",
+}
+
+// TableInfo describes a relation. EstimatedRows comes from pg_class.reltuples:
+// PostgreSQL 14+ reports -1 for a relation that has never been vacuumed or
+// analyzed, older servers report 0, the same as an empty table. Zero times
+// mean the operation never ran.
+type TableInfo struct {
+	Schema          string
+	Name            string
+	Kind            TableKind
+	Owner           string
+	EstimatedRows   int64
+	HeapSize        int64
+	IndexSize       int64
+	ToastSize       int64
+	TotalSize       int64
+	LastVacuum      time.Time
+	LastAutovacuum  time.Time
+	LastAnalyze     time.Time
+	LastAutoanalyze time.Time
+}
+
+type DescribeTablesOptions struct {
+	// Schemas limits the result to these schemas, all non-system schemas by default
+	Schemas []string
+	// Kinds limits the result to these kinds, all kinds by default
+	Kinds []TableKind
+}
+
+func (c *PostgresController) DescribeTables(dbName string, opts DescribeTablesOptions) ([]TableInfo, error) {
+	err := validateDBName(dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	kinds := opts.Kinds
+	if len(kinds) == 0 {
+		kinds = []TableKind{TableKindTable, TableKindPartitionedTable, TableKindView, TableKindMaterializedView, TableKindForeignTable}
+	}
+	var codes []string
+	for _, kind := range kinds {
+		code, ok := tableKindCodes[kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown table kind %q", kind)
+		}
+		codes = append(codes, code)
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT n.nspname,
+			c.relname,
+			c.relkind::text,
+			pg_catalog.pg_get_userbyid(c.relowner),
+			c.reltuples::bigint,
+			pg_catalog.pg_relation_size(c.oid),
+			pg_catalog.pg_indexes_size(c.oid),
+			CASE WHEN c.reltoastrelid = 0 THEN 0
+				ELSE pg_catalog.pg_total_relation_size(c.reltoastrelid) END,
+			pg_catalog.pg_total_relation_size(c.oid),
+			s.last_vacuum,
+			s.last_autovacuum,
+			s.last_analyze,
+			s.last_autoanalyze
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_stat_all_tables s ON s.relid = c.oid
+		WHERE c.relkind::text = ANY($1)
+		AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		AND n.nspname NOT LIKE 'pg\_toast%'
+		AND n.nspname NOT LIKE 'pg\_temp\_%'
+		AND (COALESCE(cardinality($2::text[]), 0) = 0 OR n.nspname = ANY($2))
+		ORDER BY n.nspname, c.relname
+	`, pq.Array(codes), pq.Array(opts.Schemas))
+	if err != nil {
+		return nil, fmt.Errorf("error describing tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []TableInfo
+	for rows.Next() {
+		var info TableInfo
+		var code string
+		var lastVacuum, lastAutovacuum, lastAnalyze, lastAutoanalyze sql.NullTime
+		err = rows.Scan(
+			&info.Schema,
+			&info.Name,
+			&code,
+			&info.Owner,
+			&info.EstimatedRows,
+			&info.HeapSize,
+			&info.IndexSize,
+			&info.ToastSize,
+			&info.TotalSize,
+			&lastVacuum,
+			&lastAutovacuum,
+			&lastAnalyze,
+			&lastAutoanalyze,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning table: %w", err)
+		}
+		info.Kind = tableKindFromCode(code)
+		info.LastVacuum = lastVacuum.Time
+		info.LastAutovacuum = lastAutovacuum.Time
+		info.LastAnalyze = lastAnalyze.Time
+		info.LastAutoanalyze = lastAutoanalyze.Time
+		tables = append(tables, info)
+	}
+
+	return tables, rows.Err()
+}
+
+func tableKindFromCode(code string) TableKind {
+	for kind, c := range tableKindCodes {
+		if c == code {
+			return kind
+		}
+	}
+	return TableKind(code)
+}
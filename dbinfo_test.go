@@ -0,0 +1,149 @@
+// postgresctl/dbinfo_test.go
+package postgresctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresController_DescribeDatabase(t *testing.T) {
+	testDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	_, err := c.DescribeDatabase(testDB)
+	assert.Equal(t, ErrDBDoesNotExist, err)
+
+	_, err = c.DescribeDatabase("")
+	assert.Error(t, err)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	_, err = c.db.Exec(`COMMENT ON DATABASE "` + testDB + `" IS 'tenant database'`)
+	assert.NoError(t, err)
+
+	info, err := c.DescribeDatabase(testDB)
+	assert.NoError(t, err)
+	assert.Equal(t, testDB, info.Name)
+	assert.Equal(t, "postgres", info.Owner)
+	assert.Equal(t, "UTF8", info.Encoding)
+	assert.Equal(t, "pg_default", info.Tablespace)
+	assert.Equal(t, "tenant database", info.Comment)
+	assert.Equal(t, -1, info.ConnectionLimit)
+	assert.True(t, info.AllowConnections)
+	assert.False(t, info.IsTemplate)
+	assert.Equal(t, 0, info.ActiveSessions)
+
+	size, err := c.Size(testDB)
+	assert.NoError(t, err)
+	assert.Equal(t, size, info.Size)
+}
+
+func TestPostgresController_DescribeDatabases(t *testing.T) {
+	c := createTestController()
+	defer c.Close()
+
+	for _, name := range generateTestNames() {
+		err := c.CreateDatabase(name)
+		assert.NoError(t, err)
+		defer c.DeleteDatabase(name)
+	}
+
+	infos, err := c.DescribeDatabases(DescribeDatabasesOptions{NamePattern: "test%_test"})
+	assert.NoError(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, "test4_test", infos[0].Name)
+	assert.Equal(t, "test5_test", infos[1].Name)
+
+	infos, err = c.DescribeDatabases(DescribeDatabasesOptions{NamePattern: "test%_test", Descending: true})
+	assert.NoError(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, "test5_test", infos[0].Name)
+
+	infos, err = c.DescribeDatabases(DescribeDatabasesOptions{})
+	assert.NoError(t, err)
+	for _, info := range infos {
+		assert.NotContains(t, baseDBs, info.Name)
+		assert.False(t, info.IsTemplate)
+	}
+
+	infos, err = c.DescribeDatabases(DescribeDatabasesOptions{IncludeTemplates: true, IncludeBaseDatabases: true, SortBy: SortDatabasesBySize})
+	assert.NoError(t, err)
+	var names []string
+	for i, info := range infos {
+		names = append(names, info.Name)
+		if i > 0 {
+			assert.LessOrEqual(t, infos[i-1].Size, info.Size)
+		}
+	}
+	assert.Contains(t, names, "template1")
+	assert.Contains(t, names, "postgres")
+
+	_, err = c.DescribeDatabases(DescribeDatabasesOptions{SortBy: "color"})
+	assert.Error(t, err)
+}
+
+func TestPostgresController_DescribeTables(t *testing.T) {
+	testDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	_, err := c.DescribeTables(testDB, DescribeTablesOptions{})
+	assert.Error(t, err)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	db, err := c.openDB(testDB)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE SCHEMA app;
+		CREATE TABLE app.items (id SERIAL PRIMARY KEY, payload TEXT);
+		INSERT INTO app.items (payload) SELECT repeat('x', 100) FROM generate_series(1, 1000);
+		ANALYZE app.items;
+		CREATE VIEW public.items_view AS SELECT * FROM app.items;
+		CREATE MATERIALIZED VIEW public.items_mv AS SELECT * FROM app.items;
+		CREATE TABLE public.events (id INT, at DATE) PARTITION BY RANGE (at);
+	`)
+	assert.NoError(t, err)
+
+	tables, err := c.DescribeTables(testDB, DescribeTablesOptions{})
+	assert.NoError(t, err)
+
+	byName := map[string]TableInfo{}
+	for _, table := range tables {
+		assert.NotEqual(t, "pg_catalog", table.Schema)
+		assert.NotEqual(t, "information_schema", table.Schema)
+		byName[table.Schema+"."+table.Name] = table
+	}
+
+	items := byName["app.items"]
+	assert.Equal(t, TableKindTable, items.Kind)
+	assert.Equal(t, "postgres", items.Owner)
+	assert.Equal(t, int64(1000), items.EstimatedRows)
+	assert.True(t, items.HeapSize > 0)
+	assert.True(t, items.IndexSize > 0)
+	assert.True(t, items.TotalSize >= items.HeapSize+items.IndexSize)
+	assert.False(t, items.LastAnalyze.IsZero())
+
+	assert.Equal(t, TableKindView, byName["public.items_view"].Kind)
+	assert.Equal(t, TableKindMaterializedView, byName["public.items_mv"].Kind)
+	assert.Equal(t, TableKindPartitionedTable, byName["public.events"].Kind)
+
+	tables, err = c.DescribeTables(testDB, DescribeTablesOptions{Schemas: []string{"public"}, Kinds: []TableKind{TableKindView}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(tables))
+	assert.Equal(t, "items_view", tables[0].Name)
+
+	_, err = c.DescribeTables(testDB, DescribeTablesOptions{Kinds: []TableKind{"index"}})
+	assert.Error(t, err)
+}
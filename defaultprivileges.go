@@ -0,0 +1,195 @@
+// postgresctl/defaultprivileges.go
+package postgresctl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultPrivilegeController manages the privileges objects get when they
+// are created. Unlike GrantAll, which only covers objects created by the
+// controller's own user, the creator role can be picked, e.g. the role
+// running migrations.
+type DefaultPrivilegeController interface {
+	GrantDefaultPrivileges(grant DefaultPrivilegeGrant) error
+	RevokeDefaultPrivileges(grant DefaultPrivilegeGrant) error
+	ListDefaultPrivileges(dbName string) ([]DefaultPrivilege, error)
+}
+
+var _ DefaultPrivilegeController = &PostgresController{}
+
+// Object types default privileges exist for, as in ALTER DEFAULT PRIVILEGES.
+// Types include domains and functions include procedures.
+var defaultPrivilegeKeywords = map[ObjectType]string{
+	ObjectTypeTable:    "TABLES",
+	ObjectTypeSequence: "SEQUENCES",
+	ObjectTypeFunction: "FUNCTIONS",
+	ObjectTypeType:     "TYPES",
+	ObjectTypeSchema:   "SCHEMAS",
+}
+
+type DefaultPrivilegeGrant struct {
+	Database string
+	// Creator is the role whose new objects get the privileges, empty means
+	// the controller's user. The controller's user must be a member of it.
+	Creator string
+	// Schema limits the privileges to objects created in it, empty means
+	// every schema. Must be empty for ObjectTypeSchema.
+	Schema     string
+	ObjectType ObjectType
+	// Grantee is a role name or PUBLIC
+	Grantee         string
+	Privileges      []Privilege
+	WithGrantOption bool
+}
+
+// DefaultPrivilege is one privilege objects get on creation
+type DefaultPrivilege struct {
+	Creator string
+	// Schema is empty for defaults applying to every schema
+	Schema     string
+	ObjectType ObjectType
+	// Grantee is a role name or PUBLIC
+	Grantee   string
+	Privilege Privilege
+	Grantable bool
+}
+
+func (c *PostgresController) GrantDefaultPrivileges(grant DefaultPrivilegeGrant) error {
+	return c.alterDefaultPrivileges("GRANT", grant)
+}
+
+// RevokeDefaultPrivileges undoes GrantDefaultPrivileges. Objects created in
+// the meantime keep their privileges.
+func (c *PostgresController) RevokeDefaultPrivileges(grant DefaultPrivilegeGrant) error {
+	return c.alterDefaultPrivileges("REVOKE", grant)
+}
+
+func (c *PostgresController) alterDefaultPrivileges(action string, grant DefaultPrivilegeGrant) error {
+	keyword, ok := defaultPrivilegeKeywords[grant.ObjectType]
+	if !ok {
+		return fmt.Errorf("%w: no default privileges for %q", ErrInvalidTarget, grant.ObjectType)
+	}
+	if grant.ObjectType == ObjectTypeSchema && grant.Schema != "" {
+		return fmt.Errorf("%w: default privileges on schemas can't be limited to a schema", ErrInvalidTarget)
+	}
+	privileges, err := c.validatePrivileges(grant.ObjectType, grant.Privileges)
+	if err != nil {
+		return err
+	}
+	grantee, err := quoteGrantee(grant.Grantee)
+	if err != nil {
+		return err
+	}
+
+	if err := validateDBName(grant.Database); err != nil {
+		return err
+	}
+	if exists, err := c.DatabaseExists(grant.Database); err != nil {
+		return err
+	} else if !exists {
+		return ErrDBDoesNotExist
+	}
+
+	stmt := "ALTER DEFAULT PRIVILEGES"
+	if grant.Creator != "" {
+		if err := validateUsername(grant.Creator); err != nil {
+			return err
+		}
+		stmt += " FOR ROLE " + quoteIdent(grant.Creator)
+	}
+	if grant.Schema != "" {
+		stmt += " IN SCHEMA " + quoteIdent(grant.Schema)
+	}
+
+	if action == "GRANT" {
+		stmt += " GRANT " + privileges + " ON " + keyword + " TO " + grantee
+		if grant.WithGrantOption {
+			if grantee == "PUBLIC" {
+				return fmt.Errorf("%w: grant options can't be granted to PUBLIC", ErrInvalidPrivilege)
+			}
+			stmt += " WITH GRANT OPTION"
+		}
+	} else {
+		if grant.WithGrantOption {
+			return fmt.Errorf("%w: WithGrantOption only applies to grants", ErrInvalidPrivilege)
+		}
+		stmt += " REVOKE " + privileges + " ON " + keyword + " FROM " + grantee
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	db, err := c.openDB(grant.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(stmt); err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			if strings.Contains(err.Error(), "schema") {
+				return fmt.Errorf("%w: %w", ErrObjectDoesNotExist, err)
+			}
+			return fmt.Errorf("%w: %w", ErrUserDoesNotExist, err)
+		}
+		return fmt.Errorf("error altering default privileges: %w", err)
+	}
+	return nil
+}
+
+// ListDefaultPrivileges decodes pg_default_acl of dbName. Only defaults that
+// were altered are listed, built-in defaults aren't.
+func (c *PostgresController) ListDefaultPrivileges(dbName string) ([]DefaultPrivilege, error) {
+	if err := validateDBName(dbName); err != nil {
+		return nil, err
+	}
+	if exists, err := c.DatabaseExists(dbName); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, ErrDBDoesNotExist
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT pg_catalog.pg_get_userbyid(d.defaclrole),
+			COALESCE(n.nspname, ''),
+			CASE d.defaclobjtype
+				WHEN 'r' THEN 'table'
+				WHEN 'S' THEN 'sequence'
+				WHEN 'f' THEN 'function'
+				WHEN 'T' THEN 'type'
+				WHEN 'n' THEN 'schema'
+			END,
+			CASE a.grantee WHEN 0 THEN 'PUBLIC' ELSE pg_catalog.pg_get_userbyid(a.grantee) END,
+			a.privilege_type, a.is_grantable
+		FROM pg_default_acl d
+		LEFT JOIN pg_namespace n ON n.oid = d.defaclnamespace
+		CROSS JOIN aclexplode(d.defaclacl) a
+		ORDER BY 1, 2, 3, 4, 5
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing default privileges: %w", err)
+	}
+	defer rows.Close()
+
+	var defaults []DefaultPrivilege
+	for rows.Next() {
+		var d DefaultPrivilege
+		var objectType, privilege string
+		if err := rows.Scan(&d.Creator, &d.Schema, &objectType, &d.Grantee, &privilege, &d.Grantable); err != nil {
+			return nil, fmt.Errorf("error scanning default privilege: %w", err)
+		}
+		d.ObjectType = ObjectType(objectType)
+		d.Privilege = Privilege(privilege)
+		defaults = append(defaults, d)
+	}
+
+	return defaults, rows.Err()
+}
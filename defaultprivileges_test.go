@@ -0,0 +1,90 @@
+// postgresctl/defaultprivileges_test.go
+package postgresctl
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresController_DefaultPrivileges(t *testing.T) {
+	testDB := testDB()
+	migrator := testUser()
+	reader := testUser()
+	testPassword := testPassword()
+
+	c := createTestController()
+	defer c.Close()
+
+	for _, user := range []string{migrator, reader} {
+		err := c.CreateUser(user, testPassword)
+		assert.NoError(t, err)
+		defer c.DeleteUser(user)
+	}
+
+	err := c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	err = c.GrantPrivileges(PrivilegeGrant{
+		Grantee:    migrator,
+		Privileges: []Privilege{PrivilegeCreate, PrivilegeUsage},
+		Target:     Target{Type: ObjectTypeSchema, Database: testDB, Name: "public"},
+	})
+	assert.NoError(t, err)
+
+	grant := DefaultPrivilegeGrant{
+		Database:   testDB,
+		Creator:    migrator,
+		Schema:     "public",
+		ObjectType: ObjectTypeTable,
+		Grantee:    reader,
+		Privileges: []Privilege{PrivilegeSelect},
+	}
+
+	invalid := grant
+	invalid.Privileges = []Privilege{PrivilegeExecute}
+	assert.ErrorIs(t, c.GrantDefaultPrivileges(invalid), ErrInvalidPrivilege)
+	invalid = grant
+	invalid.ObjectType = ObjectTypeDatabase
+	assert.ErrorIs(t, c.GrantDefaultPrivileges(invalid), ErrInvalidTarget)
+	invalid = grant
+	invalid.Schema = "missing"
+	assert.ErrorIs(t, c.GrantDefaultPrivileges(invalid), ErrObjectDoesNotExist)
+
+	err = c.GrantDefaultPrivileges(grant)
+	assert.NoError(t, err)
+	err = c.GrantDefaultPrivileges(DefaultPrivilegeGrant{
+		Database:   testDB,
+		Creator:    migrator,
+		ObjectType: ObjectTypeSequence,
+		Grantee:    reader,
+		Privileges: []Privilege{PrivilegeUsage},
+	})
+	assert.NoError(t, err)
+
+	defaults, err := c.ListDefaultPrivileges(testDB)
+	assert.NoError(t, err)
+	assert.Contains(t, defaults, DefaultPrivilege{Creator: migrator, Schema: "public", ObjectType: ObjectTypeTable, Grantee: reader, Privilege: PrivilegeSelect})
+	assert.Contains(t, defaults, DefaultPrivilege{Creator: migrator, ObjectType: ObjectTypeSequence, Grantee: reader, Privilege: PrivilegeUsage})
+
+	// Tables created by the migrator are readable right away
+	migratorDB, err := sql.Open("postgres", fmt.Sprintf("postgres://%s:%s@localhost:55432/%s?sslmode=disable", migrator, testPassword, testDB))
+	assert.NoError(t, err)
+	defer migratorDB.Close()
+	_, err = migratorDB.Exec(`CREATE TABLE events (id int)`)
+	assert.NoError(t, err)
+
+	entries, err := c.ListPrivileges(testDB)
+	assert.NoError(t, err)
+	assert.Contains(t, entries, PrivilegeEntry{Grantee: reader, Grantor: migrator, Privilege: PrivilegeSelect, Target: Target{Type: ObjectTypeTable, Database: testDB, Schema: "public", Name: "events"}})
+
+	err = c.RevokeDefaultPrivileges(grant)
+	assert.NoError(t, err)
+
+	defaults, err = c.ListDefaultPrivileges(testDB)
+	assert.NoError(t, err)
+	assert.NotContains(t, defaults, DefaultPrivilege{Creator: migrator, Schema: "public", ObjectType: ObjectTypeTable, Grantee: reader, Privilege: PrivilegeSelect})
+}
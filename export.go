@@ -0,0 +1,614 @@
+// postgresctl/export.go
+package postgresctl
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+// An export is an uncompressed tar archive with these entries, in order:
+//
+//	manifest.json                  format version, source database and tables
+//	schema.sql                     DDL run before loading data
+//	data/<n>.csv                   one file per table listed in the manifest
+//	post-data.sql                  constraints, indexes and sequence positions
+//
+// Data files use the CSV dialect of COPY ... (FORMAT csv, HEADER): the first
+// line holds the column names, every non-NULL value is quoted and NULL is an
+// empty unquoted field. Values are in PostgreSQL's text representation.
+// Data files are numbered, schema and table names are only kept in the
+// manifest so they can't clash or escape data/.
+// See schemaDump for which objects are part of schema.sql.
+type DumpController interface {
+	ExportDatabase(dbName string, w io.Writer, opts ExportOptions) error
+	ImportDatabase(dbName string, r io.Reader) error
+}
+
+var _ DumpController = &PostgresController{}
+
+const (
+	exportFormatVersion = 1
+
+	exportManifestFile = "manifest.json"
+	exportSchemaFile   = "schema.sql"
+	exportPostDataFile = "post-data.sql"
+	exportDataDir      = "data/"
+)
+
+var (
+	ErrInvalidExport = fmt.Errorf("invalid export archive")
+)
+
+type ExportOptions struct {
+	// Schemas limits the export to these schemas, all user schemas by default
+	Schemas []string
+	// SchemaOnly skips table data
+	SchemaOnly bool
+}
+
+type exportManifest struct {
+	Version    int           `json:"version"`
+	Database   string        `json:"database"`
+	ExportedAt time.Time     `json:"exported_at"`
+	Tables     []exportTable `json:"tables"`
+}
+
+type exportTable struct {
+	Schema  string   `json:"schema"`
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	File    string   `json:"file,omitempty"`
+	Rows    int64    `json:"rows"`
+}
+
+// ExportDatabase writes dbName to w from a single snapshot. Table data is
+// spooled to temporary files first, since tar needs every entry's size
+// upfront.
+func (c *PostgresController) ExportDatabase(dbName string, w io.Writer, opts ExportOptions) error {
+	if err := validateDBName(dbName); err != nil {
+		return err
+	}
+	if exists, err := c.DatabaseExists(dbName); err != nil {
+		return err
+	} else if !exists {
+		return ErrDBDoesNotExist
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting export transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY`)
+	if err != nil {
+		return fmt.Errorf("error starting export transaction: %w", err)
+	}
+
+	dump, err := dumpSchema(tx, opts.Schemas)
+	if err != nil {
+		return err
+	}
+
+	manifest := exportManifest{
+		Version:    exportFormatVersion,
+		Database:   dbName,
+		ExportedAt: time.Now().UTC(),
+	}
+
+	var spools []*os.File
+	defer func() {
+		for _, f := range spools {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	ctx := context.Background()
+	var snapshot *pgconn.PgConn
+	if !opts.SchemaOnly {
+		snapshot, err = c.openSnapshotConn(ctx, dbName, tx)
+		if err != nil {
+			return err
+		}
+		defer snapshot.Close(ctx)
+	}
+
+	for _, t := range dump.Tables {
+		table := exportTable{Schema: t.Schema, Name: t.Name, Columns: t.Columns}
+		// Tables without columns can't be loaded through COPY
+		if !opts.SchemaOnly && len(t.Columns) > 0 {
+			f, err := os.CreateTemp("", "pgctl-export-*.csv")
+			if err != nil {
+				return fmt.Errorf("error creating spool file: %w", err)
+			}
+			spools = append(spools, f)
+
+			table.Rows, err = copyTableOut(ctx, snapshot, t, f, nil)
+			if err != nil {
+				return fmt.Errorf("error exporting %s.%s: %w", t.Schema, t.Name, err)
+			}
+			table.File = fmt.Sprintf("%s%05d.csv", exportDataDir, len(spools))
+		}
+		manifest.Tables = append(manifest.Tables, table)
+	}
+
+	meta, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	if err := writeTarFile(tw, exportManifestFile, bytes.NewReader(meta), int64(len(meta))); err != nil {
+		return err
+	}
+
+	schema := joinStatements(dump.PreData)
+	if err := writeTarFile(tw, exportSchemaFile, strings.NewReader(schema), int64(len(schema))); err != nil {
+		return err
+	}
+
+	i := 0
+	for _, t := range manifest.Tables {
+		if t.File == "" {
+			continue
+		}
+		f := spools[i]
+		i++
+
+		size, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := writeTarFile(tw, t.File, f, size); err != nil {
+			return err
+		}
+	}
+
+	postData := joinStatements(dump.PostData)
+	if err := writeTarFile(tw, exportPostDataFile, strings.NewReader(postData), int64(len(postData))); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// ImportDatabase creates dbName from an export written by ExportDatabase.
+// The database must not exist yet, it is dropped again if the import fails.
+func (c *PostgresController) ImportDatabase(dbName string, r io.Reader) (err error) {
+	if err := validateDBName(dbName); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+
+	var manifest exportManifest
+	if err := readTarJSON(tr, exportManifestFile, &manifest); err != nil {
+		return err
+	}
+	if manifest.Version != exportFormatVersion {
+		return fmt.Errorf("%w: unsupported format version %d", ErrInvalidExport, manifest.Version)
+	}
+
+	schema, err := readTarFile(tr, exportSchemaFile)
+	if err != nil {
+		return err
+	}
+
+	if err := c.CreateDatabase(dbName); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_, dropErr := c.db.Exec(`DROP DATABASE IF EXISTS "` + dbName + `"`)
+			err = errors.Join(err, dropErr)
+		}
+	}()
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(schema); err != nil {
+		return fmt.Errorf("error restoring schema: %w", err)
+	}
+
+	tables := map[string]exportTable{}
+	for _, t := range manifest.Tables {
+		if t.File != "" {
+			tables[t.File] = t
+		}
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("%w: missing %s", ErrInvalidExport, exportPostDataFile)
+			}
+			return fmt.Errorf("error reading export: %w", err)
+		}
+
+		if hdr.Name == exportPostDataFile {
+			if len(tables) > 0 {
+				return fmt.Errorf("%w: %d data files missing", ErrInvalidExport, len(tables))
+			}
+
+			postData, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("error reading export: %w", err)
+			}
+			if len(postData) == 0 {
+				return nil
+			}
+			if _, err := db.Exec(string(postData)); err != nil {
+				return fmt.Errorf("error restoring constraints and indexes: %w", err)
+			}
+			return nil
+		}
+
+		t, ok := tables[hdr.Name]
+		if !ok {
+			return fmt.Errorf("%w: unexpected entry %s", ErrInvalidExport, hdr.Name)
+		}
+		delete(tables, hdr.Name)
+
+		rows, err := importTableData(context.Background(), db, t, tr)
+		if err != nil {
+			return fmt.Errorf("error importing %s.%s: %w", t.Schema, t.Name, err)
+		}
+		if rows != t.Rows {
+			return fmt.Errorf("error importing %s.%s: loaded %d rows, expected %d", t.Schema, t.Name, rows, t.Rows)
+		}
+	}
+}
+
+// openSnapshotConn opens a second connection to dbName that shares the
+// snapshot of tx, which must be a REPEATABLE READ transaction. lib/pq can't
+// run COPY ... TO STDOUT, the connection is used for that.
+func (c *PostgresController) openSnapshotConn(ctx context.Context, dbName string, tx *sql.Tx) (*pgconn.PgConn, error) {
+	var snapshot string
+	err := tx.QueryRowContext(ctx, `SELECT pg_export_snapshot()`).Scan(&snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting snapshot: %w", err)
+	}
+
+	pc := c.pc
+	pc.Database = dbName
+	conn, err := pgconn.Connect(ctx, pc.keywordConnStr())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database %s: %w", dbName, err)
+	}
+
+	// Output settings match what lib/pq uses, so values read the same
+	// through either connection
+	_, err = conn.Exec(ctx, `
+		BEGIN ISOLATION LEVEL REPEATABLE READ, READ ONLY;
+		SET TRANSACTION SNAPSHOT `+quoteLiteral(snapshot)+`;
+		SET LOCAL client_encoding = 'UTF8';
+		SET LOCAL DateStyle = 'ISO, MDY';
+		SET LOCAL extra_float_digits = 2;
+	`).ReadAll()
+	if err != nil {
+		conn.Close(ctx)
+		return nil, fmt.Errorf("error attaching to snapshot: %w", err)
+	}
+
+	return conn, nil
+}
+
+// copyTableOut writes the rows of t to w in the export's CSV dialect with
+// COPY ... TO STDOUT, after a header line. update, if set, is called every
+// copyProgressRows rows.
+func copyTableOut(ctx context.Context, conn *pgconn.PgConn, t dumpTable, w io.Writer, update func(rows int64)) (int64, error) {
+	bw := bufio.NewWriter(w)
+	if err := writeCSVHeader(bw, t.Columns); err != nil {
+		return 0, err
+	}
+
+	columns := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		columns[i] = quoteIdent(col)
+	}
+	// FORCE_QUOTE keeps NULL and the empty string apart, see writeCSVRecord
+	query := "COPY (SELECT " + strings.Join(columns, ", ") + " FROM ONLY " + quoteIdent(t.Schema) + "." + quoteIdent(t.Name) + ") " +
+		"TO STDOUT (FORMAT csv, FORCE_QUOTE *)"
+
+	counter := &csvRowCounter{w: bw, update: update}
+	tag, err := conn.CopyTo(ctx, counter, query)
+	if err != nil {
+		return counter.rows, err
+	}
+
+	return tag.RowsAffected(), bw.Flush()
+}
+
+// csvRowCounter passes CSV through and counts the records in it, a newline
+// outside of quotes ends a record.
+type csvRowCounter struct {
+	w      io.Writer
+	update func(rows int64)
+	quoted bool
+	rows   int64
+}
+
+func (rc *csvRowCounter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		switch {
+		case b == '"':
+			rc.quoted = !rc.quoted
+		case b == '\n' && !rc.quoted:
+			rc.rows++
+			if rc.update != nil && rc.rows%copyProgressRows == 0 {
+				rc.update(rc.rows)
+			}
+		}
+	}
+	return rc.w.Write(p)
+}
+
+func importTableData(ctx context.Context, db *sql.DB, t exportTable, r io.Reader) (int64, error) {
+	cr := newCSVReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return 0, fmt.Errorf("%w: error reading header: %w", ErrInvalidExport, err)
+	}
+	columns := make([]string, len(header))
+	for i, h := range header {
+		columns[i] = h.String
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyInSchema(t.Schema, t.Name, columns...))
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	args := make([]any, len(columns))
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			stmt.Close()
+			return count, fmt.Errorf("%w: %w", ErrInvalidExport, err)
+		}
+		if len(record) != len(columns) {
+			stmt.Close()
+			return count, fmt.Errorf("%w: row %d has %d fields, expected %d", ErrInvalidExport, count+1, len(record), len(columns))
+		}
+
+		for i, v := range record {
+			if v.Valid {
+				args[i] = v.String
+			} else {
+				args[i] = nil
+			}
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			stmt.Close()
+			return count, err
+		}
+		count++
+	}
+
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return count, err
+	}
+	if err := stmt.Close(); err != nil {
+		return count, err
+	}
+
+	return count, tx.Commit()
+}
+
+func joinStatements(stmts []string) string {
+	if len(stmts) == 0 {
+		return ""
+	}
+	return strings.Join(stmts, "\n\n") + "\n"
+}
+
+func writeTarFile(tw *tar.Writer, name string, r io.Reader, size int64) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	return nil
+}
+
+func readTarFile(tr *tar.Reader, name string) (string, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return "", fmt.Errorf("%w: missing %s: %w", ErrInvalidExport, name, err)
+	}
+	if hdr.Name != name {
+		return "", fmt.Errorf("%w: expected %s, got %s", ErrInvalidExport, name, hdr.Name)
+	}
+
+	data, err := io.ReadAll(tr)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", name, err)
+	}
+	return string(data), nil
+}
+
+func readTarJSON(tr *tar.Reader, name string, v any) error {
+	data, err := readTarFile(tr, name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return fmt.Errorf("%w: error parsing %s: %w", ErrInvalidExport, name, err)
+	}
+	return nil
+}
+
+func writeCSVHeader(w *bufio.Writer, columns []string) error {
+	values := make([]sql.NullString, len(columns))
+	for i, col := range columns {
+		values[i] = sql.NullString{String: col, Valid: true}
+	}
+	return writeCSVRecord(w, values)
+}
+
+// writeCSVRecord quotes every non-NULL value so that NULL and the empty
+// string stay distinct, like COPY ... (FORMAT csv) does.
+func writeCSVRecord(w *bufio.Writer, values []sql.NullString) error {
+	for i, v := range values {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		if !v.Valid {
+			continue
+		}
+		w.WriteByte('"')
+		w.WriteString(strings.ReplaceAll(v.String, `"`, `""`))
+		w.WriteByte('"')
+	}
+	_, err := w.WriteString("\n")
+	return err
+}
+
+// csvReader reads records written by writeCSVRecord. encoding/csv can't be
+// used, it doesn't tell a NULL from an empty string.
+type csvReader struct {
+	r *bufio.Reader
+}
+
+func newCSVReader(r io.Reader) *csvReader {
+	return &csvReader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record, or io.EOF when there are none left.
+func (cr *csvReader) Read() ([]sql.NullString, error) {
+	if _, err := cr.r.Peek(1); err != nil {
+		return nil, err
+	}
+
+	var record []sql.NullString
+	for {
+		field, last, err := cr.readField()
+		if err != nil {
+			return nil, err
+		}
+		record = append(record, field)
+		if last {
+			return record, nil
+		}
+	}
+}
+
+// readField reads one field and the separator after it, last is set when
+// the separator ended the record.
+func (cr *csvReader) readField() (field sql.NullString, last bool, err error) {
+	b, err := cr.r.ReadByte()
+	if err == io.EOF {
+		return field, true, nil
+	}
+	if err != nil {
+		return field, false, err
+	}
+
+	if b != '"' {
+		// Only NULL is written unquoted
+		switch b {
+		case ',':
+			return field, false, nil
+		case '\n':
+			return field, true, nil
+		case '\r':
+			return field, true, cr.skipNewline()
+		}
+		return field, false, fmt.Errorf("unexpected unquoted value")
+	}
+
+	var sb strings.Builder
+	for {
+		b, err := cr.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return field, false, err
+		}
+		if b != '"' {
+			sb.WriteByte(b)
+			continue
+		}
+
+		next, err := cr.r.ReadByte()
+		if err == io.EOF {
+			return sql.NullString{String: sb.String(), Valid: true}, true, nil
+		}
+		if err != nil {
+			return field, false, err
+		}
+		switch next {
+		case '"':
+			sb.WriteByte('"')
+		case ',':
+			return sql.NullString{String: sb.String(), Valid: true}, false, nil
+		case '\n':
+			return sql.NullString{String: sb.String(), Valid: true}, true, nil
+		case '\r':
+			return sql.NullString{String: sb.String(), Valid: true}, true, cr.skipNewline()
+		default:
+			return field, false, fmt.Errorf("unexpected %q after closing quote", next)
+		}
+	}
+}
+
+func (cr *csvReader) skipNewline() error {
+	b, err := cr.r.ReadByte()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if b != '\n' {
+		return cr.r.UnreadByte()
+	}
+	return nil
+}
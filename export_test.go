@@ -0,0 +1,259 @@
+// postgresctl/export_test.go
+package postgresctl
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	records := [][]sql.NullString{
+		{{String: "id", Valid: true}, {String: "note", Valid: true}},
+		{{String: "1", Valid: true}, {String: "", Valid: true}},
+		{{String: "2", Valid: true}, {}},
+		{{String: "3", Valid: true}, {String: "a \"quoted\", multi\nline\r\nvalue", Valid: true}},
+		{{}, {}},
+	}
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	for _, r := range records {
+		assert.NoError(t, writeCSVRecord(w, r))
+	}
+	assert.NoError(t, w.Flush())
+	assert.True(t, strings.HasPrefix(buf.String(), "\"id\",\"note\"\n\"1\",\"\"\n\"2\",\n"))
+
+	cr := newCSVReader(&buf)
+	for _, want := range records {
+		got, err := cr.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := cr.Read()
+	assert.Equal(t, io.EOF, err)
+
+	_, err = newCSVReader(bytes.NewBufferString("\"1\",2\n")).Read()
+	assert.Error(t, err)
+	_, err = newCSVReader(bytes.NewBufferString("\"1\",\"2\n")).Read()
+	assert.Error(t, err)
+}
+
+func TestCSVRowCounter(t *testing.T) {
+	var buf bytes.Buffer
+	var updates []int64
+	rc := &csvRowCounter{w: &buf, update: func(rows int64) { updates = append(updates, rows) }}
+
+	// Records may be split across writes and contain quoted newlines
+	data := "\"1\",\"multi\nline\"\n\"2\",\n\"3\",\"say \"\"hi\"\"\n\"\n"
+	for _, part := range []string{data[:5], data[5:14], data[14:]} {
+		_, err := rc.Write([]byte(part))
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, int64(3), rc.rows)
+	assert.Equal(t, data, buf.String())
+	assert.Empty(t, updates)
+}
+
+func TestPostgresController_ExportImportDatabase(t *testing.T) {
+	srcDB := testDB()
+	dstDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateDatabase(srcDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(srcDB)
+
+	db, err := c.openDB(srcDB)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE SCHEMA app;
+		CREATE TYPE app.status AS ENUM ('active', 'closed');
+		CREATE DOMAIN app.email AS text CHECK (VALUE LIKE '%@%');
+		CREATE TABLE app.accounts (
+			id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			email app.email NOT NULL UNIQUE,
+			status app.status NOT NULL DEFAULT 'active',
+			tags text[],
+			note text COLLATE "C",
+			data bytea,
+			name_length int GENERATED ALWAYS AS (length(email)) STORED
+		);
+		CREATE TABLE app.events (
+			id serial PRIMARY KEY,
+			account_id bigint NOT NULL REFERENCES app.accounts (id),
+			created_at timestamptz NOT NULL DEFAULT now()
+		) ;
+		CREATE INDEX events_account_idx ON app.events (account_id);
+		CREATE SCHEMA "app.events";
+		CREATE TABLE "app.events"."../escape" (v int);
+		CREATE TABLE public.measurements (at date NOT NULL, value numeric) PARTITION BY RANGE (at);
+		CREATE TABLE public.measurements_2024 PARTITION OF public.measurements FOR VALUES FROM ('2024-01-01') TO ('2025-01-01');
+		CREATE FUNCTION app.active_accounts() RETURNS bigint LANGUAGE sql AS $$ SELECT count(*) FROM app.accounts WHERE status = 'active' $$;
+		CREATE VIEW app.active AS SELECT id, email FROM app.accounts WHERE status = 'active';
+		CREATE MATERIALIZED VIEW app.totals AS SELECT status, count(*) AS n FROM app.accounts GROUP BY status;
+
+		INSERT INTO app.accounts (email, status, tags, note, data) VALUES
+			('a@example.com', 'active', '{x,"y z"}', '', '\x0001ff'),
+			('b@example.com', 'closed', NULL, NULL, NULL),
+			('c@example.com', 'active', '{}', 'multi
+line, "quoted"', '');
+		INSERT INTO app.events (account_id) SELECT id FROM app.accounts;
+		INSERT INTO "app.events"."../escape" VALUES (1), (2);
+		INSERT INTO public.measurements VALUES ('2024-05-01', 1.5), ('2024-06-01', NULL);
+		REFRESH MATERIALIZED VIEW app.totals;
+	`)
+	assert.NoError(t, err)
+
+	var archive bytes.Buffer
+	err = c.ExportDatabase(srcDB, &archive, ExportOptions{})
+	assert.NoError(t, err)
+
+	err = c.ImportDatabase(dstDB, bytes.NewReader(archive.Bytes()))
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(dstDB)
+
+	err = c.ImportDatabase(dstDB, bytes.NewReader(archive.Bytes()))
+	assert.Equal(t, ErrDBExists, err)
+
+	dst, err := c.openDB(dstDB)
+	assert.NoError(t, err)
+	defer dst.Close()
+
+	// Every table, view and function should match the source
+	for _, query := range []string{
+		`SELECT id, email, status, tags, note, data, name_length FROM app.accounts ORDER BY id`,
+		`SELECT id, account_id, created_at FROM app.events ORDER BY id`,
+		`SELECT at, value FROM public.measurements_2024 ORDER BY at`,
+		`SELECT v FROM "app.events"."../escape" ORDER BY v`,
+		`SELECT id, email FROM app.active ORDER BY id`,
+		`SELECT status, n FROM app.totals ORDER BY status`,
+		`SELECT app.active_accounts()`,
+	} {
+		assert.Equal(t, queryRows(t, db, query), queryRows(t, dst, query), query)
+	}
+
+	// Sequences continue where the source left off
+	var nextAccount, nextEvent int64
+	err = dst.QueryRow(`INSERT INTO app.accounts (email) VALUES ('d@example.com') RETURNING id`).Scan(&nextAccount)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), nextAccount)
+	err = dst.QueryRow(`INSERT INTO app.events (account_id) VALUES (4) RETURNING id`).Scan(&nextEvent)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), nextEvent)
+
+	// Constraints are restored
+	_, err = dst.Exec(`INSERT INTO app.events (account_id) VALUES (100)`)
+	assert.Error(t, err)
+	_, err = dst.Exec(`INSERT INTO app.accounts (email) VALUES ('a@example.com')`)
+	assert.Error(t, err)
+	_, err = dst.Exec(`INSERT INTO app.accounts (email) VALUES ('invalid')`)
+	assert.Error(t, err)
+
+	var indexes int
+	err = dst.QueryRow(`SELECT count(*) FROM pg_indexes WHERE schemaname = 'app' AND indexname = 'events_account_idx'`).Scan(&indexes)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, indexes)
+
+	var collation string
+	err = dst.QueryRow(`
+		SELECT collation_name FROM information_schema.columns
+		WHERE table_schema = 'app' AND table_name = 'accounts' AND column_name = 'note'
+	`).Scan(&collation)
+	assert.NoError(t, err)
+	assert.Equal(t, "C", collation)
+}
+
+func TestPostgresController_ExportSchemaOnly(t *testing.T) {
+	srcDB := testDB()
+	dstDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateDatabase(srcDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(srcDB)
+
+	db, err := c.openDB(srcDB)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE SCHEMA app;
+		CREATE TABLE app.items (id int PRIMARY KEY);
+		CREATE TABLE public.other (id int);
+		INSERT INTO app.items VALUES (1), (2);
+	`)
+	assert.NoError(t, err)
+
+	var archive bytes.Buffer
+	err = c.ExportDatabase(srcDB, &archive, ExportOptions{Schemas: []string{"app"}, SchemaOnly: true})
+	assert.NoError(t, err)
+
+	err = c.ImportDatabase(dstDB, &archive)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(dstDB)
+
+	tables, err := c.Tables(dstDB)
+	assert.NoError(t, err)
+	assert.Empty(t, tables, "only the app schema should be exported")
+
+	dst, err := c.openDB(dstDB)
+	assert.NoError(t, err)
+	defer dst.Close()
+
+	var count int
+	err = dst.QueryRow(`SELECT count(*) FROM app.items`).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestPostgresController_ImportDatabase_Invalid(t *testing.T) {
+	dstDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.ImportDatabase(dstDB, bytes.NewBufferString("not a tar archive"))
+	assert.ErrorIs(t, err, ErrInvalidExport)
+
+	exists, err := c.DatabaseExists(dstDB)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func queryRows(t *testing.T, db *sql.DB, query string) [][]sql.NullString {
+	rows, err := db.Query(query)
+	assert.NoError(t, err)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	assert.NoError(t, err)
+
+	var result [][]sql.NullString
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		assert.NoError(t, rows.Scan(dest...))
+		result = append(result, values)
+	}
+	assert.NoError(t, rows.Err())
+	return result
+}
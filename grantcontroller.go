@@ -2,6 +2,7 @@
 package postgresctl
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -13,7 +14,10 @@ type GrantController interface {
 	GrantAll(dbName, username string) error
 	RevokeAll(dbName, username string) error
 	Revoke(grantName, dbName, username string) error
+	GrantWithOptions(grantName, dbName, username string, opts GrantOptions) error
+	RevokeWithOptions(grantName, dbName, username string, opts GrantOptions) error
 	RevokePublicDatabaseAccess(dbName string) error
+	RevokePublicSchemaCreate(dbName string) error
 }
 
 var _ GrantController = &PostgresController{}
@@ -36,6 +40,8 @@ var grants = map[string]string{
 	"EXECUTE":    "EXECUTE",
 	"USAGE":      "USAGE",
 	"CREATE":     "CREATE",
+	// PostgreSQL 17+
+	"MAINTAIN": "MAINTAIN",
 }
 
 func (c *PostgresController) GrantAll(dbName, username string) error {
@@ -46,6 +52,10 @@ func (c *PostgresController) GrantAll(dbName, username string) error {
 		return fmt.Errorf("error validating username: %w", err)
 	}
 
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
 	// Check existence
 	if exists, err := c.UserExists(username); err != nil {
 		return fmt.Errorf("error checking user: %w", err)
@@ -97,6 +107,10 @@ func (c *PostgresController) RevokeAll(dbName, username string) error {
 		return fmt.Errorf("error validating username: %w", err)
 	}
 
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
 	// Revoke CONNECT
 	if _, err := c.db.Exec(`REVOKE CONNECT ON DATABASE "` + dbName + `" FROM "` + username + `"`); err != nil {
 		return fmt.Errorf("error revoking CONNECT: %w", err)
@@ -131,6 +145,12 @@ func (c *PostgresController) RevokeAll(dbName, username string) error {
 }
 
 func (c *PostgresController) Grant(grantName, dbName, username string) error {
+	return c.GrantWithOptions(grantName, dbName, username, GrantOptions{})
+}
+
+// GrantWithOptions is Grant with grant options, see PrivilegeGrant. Default
+// privileges don't record GrantedBy.
+func (c *PostgresController) GrantWithOptions(grantName, dbName, username string, opts GrantOptions) error {
 	if err := validateDBName(dbName); err != nil {
 		return fmt.Errorf("error validating database name: %w", err)
 	}
@@ -141,41 +161,61 @@ func (c *PostgresController) Grant(grantName, dbName, username string) error {
 	if err := validateGrant(grantName); err != nil {
 		return fmt.Errorf("error validating grant: %w", err)
 	}
+	if grantName == "MAINTAIN" {
+		if err := c.requireVersion("the MAINTAIN privilege", postgres17); err != nil {
+			return err
+		}
+	}
+
+	_, options, err := c.grantOptions("GRANT", username, opts)
+	if err != nil {
+		return err
+	}
+	// ALTER DEFAULT PRIVILEGES has no GRANTED BY
+	opts.GrantedBy = ""
+	_, defaultOptions, err := c.grantOptions("GRANT", username, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
 
 	switch grantName {
 	case "CONNECT", "TEMPORARY":
-		_, err := c.db.Exec(`GRANT ` + grantName + ` ON DATABASE "` + dbName + `" TO "` + username + `"`)
+		_, err := c.db.Exec(`GRANT ` + grantName + ` ON DATABASE "` + dbName + `" TO "` + username + `"` + options)
 		return err
 
 	case "USAGE":
-		_, err := c.db.Exec(`GRANT USAGE ON SCHEMA public TO "` + username + `"`)
+		_, err := c.db.Exec(`GRANT USAGE ON SCHEMA public TO "` + username + `"` + options)
 		if err != nil {
 			return fmt.Errorf("error granting schema USAGE: %w", err)
 		}
-		_, err = c.db.Exec(`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE ON SEQUENCES TO "` + username + `"`)
+		_, err = c.db.Exec(`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE ON SEQUENCES TO "` + username + `"` + defaultOptions)
 		return err
 
 	case "CREATE":
-		_, err := c.db.Exec(`GRANT CREATE ON SCHEMA public TO "` + username + `"`)
+		_, err := c.db.Exec(`GRANT CREATE ON SCHEMA public TO "` + username + `"` + options)
 		if err != nil {
 			return fmt.Errorf("error granting schema CREATE: %w", err)
 		}
 		// Optional: add default privileges for created objects if needed
 
 	case "EXECUTE":
-		_, err := c.db.Exec(`GRANT EXECUTE ON ALL FUNCTIONS IN SCHEMA public TO "` + username + `"`)
+		_, err := c.db.Exec(`GRANT EXECUTE ON ALL FUNCTIONS IN SCHEMA public TO "` + username + `"` + options)
 		if err != nil {
 			return fmt.Errorf("error granting EXECUTE: %w", err)
 		}
-		_, err = c.db.Exec(`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT EXECUTE ON FUNCTIONS TO "` + username + `"`)
+		_, err = c.db.Exec(`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT EXECUTE ON FUNCTIONS TO "` + username + `"` + defaultOptions)
 		return err
 
 	default:
-		_, err := c.db.Exec(`GRANT ` + grantName + ` ON ALL TABLES IN SCHEMA public TO "` + username + `"`)
+		_, err := c.db.Exec(`GRANT ` + grantName + ` ON ALL TABLES IN SCHEMA public TO "` + username + `"` + options)
 		if err != nil {
 			return fmt.Errorf("error granting table privileges: %w", err)
 		}
-		_, err = c.db.Exec(`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT ` + grantName + ` ON TABLES TO "` + username + `"`)
+		_, err = c.db.Exec(`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT ` + grantName + ` ON TABLES TO "` + username + `"` + defaultOptions)
 		return err
 	}
 
@@ -183,6 +223,12 @@ func (c *PostgresController) Grant(grantName, dbName, username string) error {
 }
 
 func (c *PostgresController) Revoke(grantName, dbName, username string) error {
+	return c.RevokeWithOptions(grantName, dbName, username, GrantOptions{})
+}
+
+// RevokeWithOptions is Revoke with the revoke options of PrivilegeGrant.
+// Default privileges don't record GrantedBy.
+func (c *PostgresController) RevokeWithOptions(grantName, dbName, username string, opts GrantOptions) error {
 	if err := validateDBName(dbName); err != nil {
 		return fmt.Errorf("error validating database name: %w", err)
 	}
@@ -194,9 +240,28 @@ func (c *PostgresController) Revoke(grantName, dbName, username string) error {
 	if err := validateGrant(grantName); err != nil {
 		return fmt.Errorf("error validating grant: %w", err)
 	}
+	if grantName == "MAINTAIN" {
+		if err := c.requireVersion("the MAINTAIN privilege", postgres17); err != nil {
+			return err
+		}
+	}
+
+	prefix, options, err := c.grantOptions("REVOKE", username, opts)
+	if err != nil {
+		return err
+	}
+	opts.GrantedBy = ""
+	_, defaultOptions, err := c.grantOptions("REVOKE", username, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
 
 	if grantName == "CONNECT" {
-		_, err := c.db.Exec(`REVOKE CONNECT ON DATABASE "` + dbName + `" FROM "` + username + `"`)
+		_, err := c.db.Exec(`REVOKE ` + prefix + `CONNECT ON DATABASE "` + dbName + `" FROM "` + username + `"` + options)
 		if err != nil {
 			return fmt.Errorf("error revoking CONNECT privilege: %w", err)
 		}
@@ -204,20 +269,20 @@ func (c *PostgresController) Revoke(grantName, dbName, username string) error {
 	}
 
 	// Revoke from all tables
-	if _, err := c.db.Exec(`REVOKE ` + grantName + ` ON ALL TABLES IN SCHEMA public FROM "` + username + `"`); err != nil {
+	if _, err := c.db.Exec(`REVOKE ` + prefix + grantName + ` ON ALL TABLES IN SCHEMA public FROM "` + username + `"` + options); err != nil {
 		return fmt.Errorf("error revoking table privileges: %w", err)
 	}
 
 	// Revoke default privileges
 	if _, err := c.db.Exec(`
 		ALTER DEFAULT PRIVILEGES IN SCHEMA public
-		REVOKE ` + grantName + ` ON TABLES FROM "` + username + `"`); err != nil {
+		REVOKE ` + prefix + grantName + ` ON TABLES FROM "` + username + `"` + defaultOptions); err != nil {
 		return fmt.Errorf("error revoking default table privileges: %w", err)
 	}
 
 	// Revoke schema-level privilege if applicable
 	if grantName == "USAGE" || grantName == "CREATE" {
-		if _, err := c.db.Exec(`REVOKE ` + grantName + ` ON SCHEMA public FROM "` + username + `"`); err != nil {
+		if _, err := c.db.Exec(`REVOKE ` + prefix + grantName + ` ON SCHEMA public FROM "` + username + `"` + options); err != nil {
 			return fmt.Errorf("error revoking schema privilege: %w", err)
 		}
 	}
@@ -230,6 +295,10 @@ func (c *PostgresController) RevokePublicDatabaseAccess(dbName string) error {
 		return fmt.Errorf("error validating database name: %w", err)
 	}
 
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
 	_, err := c.db.Exec(
 		`REVOKE CONNECT, TEMPORARY ON DATABASE "` + dbName + `" FROM PUBLIC`,
 	)
@@ -240,6 +309,114 @@ func (c *PostgresController) RevokePublicDatabaseAccess(dbName string) error {
 	return nil
 }
 
+// RevokePublicSchemaCreate takes CREATE on the public schema of dbName away
+// from PUBLIC, as PostgreSQL 15 and later do for new databases. It runs on
+// every version, databases upgraded or restored from older ones may still
+// grant it.
+func (c *PostgresController) RevokePublicSchemaCreate(dbName string) error {
+	if err := validateDBName(dbName); err != nil {
+		return fmt.Errorf("error validating database name: %w", err)
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`REVOKE CREATE ON SCHEMA public FROM PUBLIC`)
+	if err != nil {
+		return fmt.Errorf("error revoking PUBLIC schema access: %w", err)
+	}
+
+	return nil
+}
+
+// ConnectGrant is a CONNECT privilege taken away by maintenance or a quota,
+// kept to restore it later
+type ConnectGrant struct {
+	// Grantee is a role name or PUBLIC
+	Grantee   string `json:"grantee"`
+	Grantable bool   `json:"grantable,omitempty"`
+}
+
+// revokeDatabaseConnect revokes CONNECT on dbName from every role holding it,
+// including PUBLIC, and returns them so the access can be restored later.
+// Superusers are skipped since they can connect regardless. Reserved
+// usernames are included, the grants are issued directly rather than
+// through Grant and Revoke.
+func (c *PostgresController) revokeDatabaseConnect(dbName string) ([]ConnectGrant, error) {
+	rows, err := c.db.Query(`
+		SELECT CASE WHEN a.grantee = 0 THEN 'PUBLIC' ELSE pg_catalog.pg_get_userbyid(a.grantee) END,
+			bool_or(a.is_grantable)
+		FROM pg_database d, aclexplode(COALESCE(d.datacl, acldefault('d', d.datdba))) a
+		WHERE d.datname = $1
+		AND a.privilege_type = 'CONNECT'
+		AND (a.grantee = 0 OR NOT (SELECT rolsuper FROM pg_roles WHERE oid = a.grantee))
+		GROUP BY 1
+		ORDER BY 1
+	`, dbName)
+	if err != nil {
+		return nil, fmt.Errorf("error listing CONNECT grantees: %w", err)
+	}
+	defer rows.Close()
+
+	var grants []ConnectGrant
+	for rows.Next() {
+		var g ConnectGrant
+		if err := rows.Scan(&g.Grantee, &g.Grantable); err != nil {
+			return nil, fmt.Errorf("error scanning CONNECT grantee: %w", err)
+		}
+		grants = append(grants, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, g := range grants {
+		// CASCADE also drops grants made through the grant option, those
+		// grantees are listed as well and get CONNECT back on restore
+		stmt := "REVOKE CONNECT ON DATABASE " + quoteIdent(dbName) + " FROM " + connectGrantee(g.Grantee)
+		if g.Grantable {
+			stmt += " CASCADE"
+		}
+		if _, err := c.db.Exec(stmt); err != nil {
+			// Give back what was already taken away
+			err = fmt.Errorf("error revoking CONNECT from %s: %w", g.Grantee, err)
+			return nil, errors.Join(err, c.restoreDatabaseConnect(dbName, grants[:i]))
+		}
+	}
+
+	return grants, nil
+}
+
+// restoreDatabaseConnect grants CONNECT back to grants returned by
+// revokeDatabaseConnect, including their grant option
+func (c *PostgresController) restoreDatabaseConnect(dbName string, grants []ConnectGrant) error {
+	for _, g := range grants {
+		stmt := "GRANT CONNECT ON DATABASE " + quoteIdent(dbName) + " TO " + connectGrantee(g.Grantee)
+		if g.Grantable {
+			stmt += " WITH GRANT OPTION"
+		}
+		if _, err := c.db.Exec(stmt); err != nil {
+			return fmt.Errorf("error restoring CONNECT for %s: %w", g.Grantee, err)
+		}
+	}
+	return nil
+}
+
+// connectGrantee quotes a grantee read from an ACL, PUBLIC is a keyword
+func connectGrantee(grantee string) string {
+	if grantee == "PUBLIC" {
+		return grantee
+	}
+	return quoteIdent(grantee)
+}
+
 // validateGrant checks if the given privilege is valid
 func validateGrant(grantName string) error {
 	if grantName == "" {
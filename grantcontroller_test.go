@@ -212,3 +212,69 @@ func TestPostgresController_RevokePublicDatabaseAccess(t *testing.T) {
 	err = openPostgres(testUser, testPassword, testDB)
 	assert.NoError(t, err, "user should be able to connect after explicit CONNECT grant")
 }
+
+func TestPostgresController_RevokeDatabaseConnect(t *testing.T) {
+	testDB := testDB()
+	testUser := testUser()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateUser(testUser, testPassword())
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	_, err = c.db.Exec(`GRANT CONNECT ON DATABASE ` + quoteIdent(testDB) + ` TO ` + quoteIdent(testUser) + ` WITH GRANT OPTION`)
+	assert.NoError(t, err)
+
+	grants, err := c.revokeDatabaseConnect(testDB)
+	assert.NoError(t, err)
+	assert.Equal(t, []ConnectGrant{{Grantee: "PUBLIC"}, {Grantee: testUser, Grantable: true}}, grants)
+
+	err = c.restoreDatabaseConnect(testDB, grants)
+	assert.NoError(t, err)
+
+	var grantable bool
+	err = c.db.QueryRow(`
+		SELECT a.is_grantable
+		FROM pg_database d, aclexplode(d.datacl) a
+		WHERE d.datname = $1 AND a.grantee = $2::regrole AND a.privilege_type = 'CONNECT'
+	`, testDB, quoteIdent(testUser)).Scan(&grantable)
+	assert.NoError(t, err)
+	assert.True(t, grantable, "the grant option should be restored")
+}
+
+func TestPostgresController_RevokePublicSchemaCreate(t *testing.T) {
+	testDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	db, err := c.openDB(testDB)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// Like a database upgraded from before PostgreSQL 15
+	_, err = db.Exec(`GRANT CREATE ON SCHEMA public TO PUBLIC`)
+	assert.NoError(t, err)
+
+	err = c.RevokePublicSchemaCreate(testDB)
+	assert.NoError(t, err)
+
+	var publicCreate bool
+	err = db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM pg_namespace n, aclexplode(COALESCE(n.nspacl, acldefault('n', n.nspowner))) a
+			WHERE n.nspname = 'public' AND a.grantee = 0 AND a.privilege_type = 'CREATE'
+		)`).Scan(&publicCreate)
+	assert.NoError(t, err)
+	assert.False(t, publicCreate)
+}
@@ -0,0 +1,237 @@
+// postgresctl/maintenance.go
+package postgresctl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type MaintenanceController interface {
+	EnterMaintenance(dbName string, opts MaintenanceOptions) (MaintenanceState, error)
+	ExitMaintenance(dbName string) error
+	MaintenanceStatus(dbName string) (MaintenanceState, bool, error)
+}
+
+var _ MaintenanceController = &PostgresController{}
+
+type MaintenanceMode string
+
+const (
+	// MaintenanceBlockConnections sets ALLOW_CONNECTIONS false, only superusers
+	// with an existing session are left
+	MaintenanceBlockConnections MaintenanceMode = "block_connections"
+	// MaintenanceRevokeConnect revokes CONNECT from every non-superuser role,
+	// so admins can still connect
+	MaintenanceRevokeConnect MaintenanceMode = "revoke_connect"
+)
+
+const (
+	// maintenanceStateSetting is a custom database setting holding the
+	// MaintenanceState, the comment is left to its owner
+	maintenanceStateSetting = "pgctl.maintenance_state"
+	maintenancePollInterval = 200 * time.Millisecond
+)
+
+var (
+	ErrInMaintenance    = fmt.Errorf("database is in maintenance")
+	ErrNotInMaintenance = fmt.Errorf("database is not in maintenance")
+)
+
+type MaintenanceOptions struct {
+	// Mode defaults to MaintenanceBlockConnections
+	Mode MaintenanceMode
+	// GracePeriod is how long existing sessions may keep running before
+	// they are terminated
+	GracePeriod time.Duration
+}
+
+// MaintenanceState records what EnterMaintenance changed so ExitMaintenance
+// can restore it. It is kept in the database's settings, so any controller
+// can end the maintenance.
+type MaintenanceState struct {
+	Database         string          `json:"-"`
+	Mode             MaintenanceMode `json:"mode"`
+	Since            time.Time       `json:"since"`
+	AllowConnections bool            `json:"allow_connections"`
+	RevokedConnect   []ConnectGrant  `json:"revoked_connect,omitempty"`
+}
+
+func (c *PostgresController) EnterMaintenance(dbName string, opts MaintenanceOptions) (MaintenanceState, error) {
+	if err := validateDBName(dbName); err != nil {
+		return MaintenanceState{}, err
+	}
+	if opts.Mode == "" {
+		opts.Mode = MaintenanceBlockConnections
+	}
+	if opts.Mode != MaintenanceBlockConnections && opts.Mode != MaintenanceRevokeConnect {
+		return MaintenanceState{}, fmt.Errorf("unknown maintenance mode %q", opts.Mode)
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return MaintenanceState{}, err
+	}
+
+	state, err := c.enterMaintenance(dbName, opts.Mode)
+	if err != nil {
+		return MaintenanceState{}, err
+	}
+
+	// The lock is not held while draining, the database is already closed
+	// and recorded so ExitMaintenance can reopen it if kicking sessions fails
+	err = c.drainDatabaseConnections(dbName, opts.GracePeriod)
+	if err != nil {
+		return state, err
+	}
+
+	return state, nil
+}
+
+func (c *PostgresController) enterMaintenance(dbName string, mode MaintenanceMode) (MaintenanceState, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok, err := c.maintenanceState(dbName); err != nil {
+		return MaintenanceState{}, err
+	} else if ok {
+		return MaintenanceState{}, ErrInMaintenance
+	}
+
+	allowConn, err := c.databaseAllowsConnections(dbName)
+	if err != nil {
+		return MaintenanceState{}, err
+	}
+
+	state := MaintenanceState{
+		Database:         dbName,
+		Mode:             mode,
+		Since:            time.Now().UTC().Truncate(time.Second),
+		AllowConnections: allowConn,
+	}
+
+	switch mode {
+	case MaintenanceBlockConnections:
+		if allowConn {
+			err = c.setAllowConnections(dbName, false)
+		}
+	case MaintenanceRevokeConnect:
+		state.RevokedConnect, err = c.revokeDatabaseConnect(dbName)
+	}
+	if err != nil {
+		return MaintenanceState{}, err
+	}
+
+	meta, err := json.Marshal(state)
+	if err == nil {
+		err = c.SetDatabaseSetting(dbName, maintenanceStateSetting, string(meta))
+	}
+	if err != nil {
+		return MaintenanceState{}, errors.Join(err, c.restoreMaintenance(state))
+	}
+
+	return state, nil
+}
+
+func (c *PostgresController) ExitMaintenance(dbName string) error {
+	if err := validateDBName(dbName); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, ok, err := c.maintenanceState(dbName)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotInMaintenance
+	}
+
+	if err := c.restoreMaintenance(state); err != nil {
+		return err
+	}
+
+	return c.ResetDatabaseSetting(dbName, maintenanceStateSetting)
+}
+
+// MaintenanceStatus returns the recorded state if dbName is in maintenance.
+func (c *PostgresController) MaintenanceStatus(dbName string) (MaintenanceState, bool, error) {
+	if err := validateDBName(dbName); err != nil {
+		return MaintenanceState{}, false, err
+	}
+
+	return c.maintenanceState(dbName)
+}
+
+func (c *PostgresController) maintenanceState(dbName string) (MaintenanceState, bool, error) {
+	settings, err := c.GetDatabaseSettings(dbName)
+	if err != nil {
+		return MaintenanceState{}, false, err
+	}
+
+	meta, ok := settings[maintenanceStateSetting]
+	if !ok {
+		return MaintenanceState{}, false, nil
+	}
+
+	var state MaintenanceState
+	if err := json.Unmarshal([]byte(meta), &state); err != nil {
+		return MaintenanceState{}, false, fmt.Errorf("error parsing maintenance state of %s: %w", dbName, err)
+	}
+	state.Database = dbName
+	return state, true, nil
+}
+
+// restoreMaintenance undoes the connection changes recorded in state.
+func (c *PostgresController) restoreMaintenance(state MaintenanceState) error {
+	switch state.Mode {
+	case MaintenanceBlockConnections:
+		if state.AllowConnections {
+			return c.setAllowConnections(state.Database, true)
+		}
+	case MaintenanceRevokeConnect:
+		return c.restoreDatabaseConnect(state.Database, state.RevokedConnect)
+	}
+	return nil
+}
+
+// drainDatabaseConnections waits up to grace for sessions on dbName to end
+// and terminates whatever is left. Superuser sessions are left alone, they
+// are not locked out by either mode.
+func (c *PostgresController) drainDatabaseConnections(dbName string, grace time.Duration) error {
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) {
+		var sessions int
+		err := c.db.QueryRow(`
+			SELECT count(*) FROM pg_stat_activity a
+			WHERE a.datname = $1
+			AND a.pid <> pg_backend_pid()
+			AND NOT COALESCE((SELECT rolsuper FROM pg_roles WHERE oid = a.usesysid), false)
+		`, dbName).Scan(&sessions)
+		if err != nil {
+			return fmt.Errorf("error counting sessions: %w", err)
+		}
+		if sessions == 0 {
+			return nil
+		}
+		time.Sleep(maintenancePollInterval)
+	}
+
+	_, err := c.db.Exec(`
+		SELECT pg_terminate_backend(a.pid)
+		FROM pg_stat_activity a
+		WHERE a.datname = $1
+		AND a.pid <> pg_backend_pid()
+		AND NOT COALESCE((SELECT rolsuper FROM pg_roles WHERE oid = a.usesysid), false)
+	`, dbName)
+	if err != nil {
+		return fmt.Errorf("error terminating connections: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// postgresctl/maintenance_test.go
+package postgresctl
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresController_MaintenanceBlockConnections(t *testing.T) {
+	testDB := testDB()
+	testUser := testUser()
+	testPassword := testPassword()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateUser(testUser, testPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	err = c.ExitMaintenance(testDB)
+	assert.Equal(t, ErrNotInMaintenance, err)
+
+	db, err := sql.Open("postgres", fmt.Sprintf("postgres://%s:%s@localhost:55432/%s?sslmode=disable", testUser, testPassword, testDB))
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, db.Ping())
+
+	err = c.setDatabaseComment(testDB, "billing data")
+	assert.NoError(t, err)
+
+	state, err := c.EnterMaintenance(testDB, MaintenanceOptions{GracePeriod: 500 * time.Millisecond})
+	assert.NoError(t, err)
+	assert.Equal(t, MaintenanceBlockConnections, state.Mode)
+	assert.True(t, state.AllowConnections)
+
+	// The comment belongs to the user, the state is kept elsewhere
+	info, err := c.DescribeDatabase(testDB)
+	assert.NoError(t, err)
+	assert.Equal(t, "billing data", info.Comment)
+
+	_, err = c.EnterMaintenance(testDB, MaintenanceOptions{})
+	assert.Equal(t, ErrInMaintenance, err)
+
+	// The state survives in the database, another controller can see it
+	other := createTestController()
+	defer other.Close()
+	recorded, ok, err := other.MaintenanceStatus(testDB)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, state, recorded)
+
+	// Existing session was kicked and new ones are refused
+	_, err = db.Exec("SELECT 1")
+	assert.Error(t, err)
+	err = openPostgres(testUser, testPassword, testDB)
+	assert.Error(t, err)
+
+	err = c.ExitMaintenance(testDB)
+	assert.NoError(t, err)
+
+	_, ok, err = c.MaintenanceStatus(testDB)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	err = openPostgres(testUser, testPassword, testDB)
+	assert.NoError(t, err)
+}
+
+func TestPostgresController_MaintenanceRevokeConnect(t *testing.T) {
+	testDB := testDB()
+	testUser := testUser()
+	testPassword := testPassword()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateUser(testUser, testPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	err = c.RevokePublicDatabaseAccess(testDB)
+	assert.NoError(t, err)
+	err = c.Grant("CONNECT", testDB, testUser)
+	assert.NoError(t, err)
+
+	state, err := c.EnterMaintenance(testDB, MaintenanceOptions{Mode: MaintenanceRevokeConnect})
+	assert.NoError(t, err)
+	assert.Equal(t, []ConnectGrant{{Grantee: testUser}}, state.RevokedConnect)
+
+	err = openPostgres(testUser, testPassword, testDB)
+	assert.Error(t, err)
+
+	// Admins can still get in
+	err = openPostgres("postgres", "password", testDB)
+	assert.NoError(t, err)
+
+	err = c.ExitMaintenance(testDB)
+	assert.NoError(t, err)
+
+	err = openPostgres(testUser, testPassword, testDB)
+	assert.NoError(t, err)
+
+	// PUBLIC access stays revoked as it was before maintenance
+	otherUser := testUser + "_other"
+	err = c.CreateUser(otherUser, testPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUser(otherUser)
+
+	err = openPostgres(otherUser, testPassword, testDB)
+	assert.Error(t, err)
+}
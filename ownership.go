@@ -0,0 +1,609 @@
+// postgresctl/ownership.go
+package postgresctl
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type DependencyType string
+
+const (
+	DependencyOwner           DependencyType = "owner"
+	DependencyPrivilege       DependencyType = "privilege"
+	DependencyPolicy          DependencyType = "policy"
+	DependencyInitPrivilege   DependencyType = "initial privilege"
+	DependencyTablespaceOwner DependencyType = "tablespace"
+)
+
+var dependencyTypes = map[string]DependencyType{
+	"o": DependencyOwner,
+	"a": DependencyPrivilege,
+	"r": DependencyPolicy,
+	"i": DependencyInitPrivilege,
+	"t": DependencyTablespaceOwner,
+}
+
+var (
+	ErrUserHasDependencies = fmt.Errorf("user has dependencies")
+	// ErrUserOwnsDatabases is returned by DeleteUserWithOptions without
+	// ReassignTo, databases are never dropped along with their owner
+	ErrUserOwnsDatabases = fmt.Errorf("user owns databases")
+)
+
+// UserDependency is an object that refers to a user. Database is empty for
+// shared objects such as databases and tablespaces.
+type UserDependency struct {
+	Database string
+	Object   string
+	Type     DependencyType
+}
+
+// OwnershipChange is an object whose owner was changed by TransferAllOwnership
+type OwnershipChange struct {
+	Kind   string
+	Schema string
+	Name   string
+}
+
+type OwnershipReport struct {
+	Database string
+	From     string
+	To       string
+	Changes  []OwnershipChange
+}
+
+// DeleteUserOptions picks what happens to what the user owns. With neither
+// ReassignTo nor DropOwned set a user with dependencies is refused.
+type DeleteUserOptions struct {
+	// ReassignTo receives ownership of everything the user owns, in every
+	// database
+	ReassignTo string
+	// DropOwned drops the objects the user owns in every database it has
+	// dependencies in, not only the connected one. Owned databases are never
+	// dropped and make the call fail with ErrUserOwnsDatabases.
+	DropOwned bool
+	// RefuseIfDependencies makes the call fail with ErrUserHasDependencies
+	// instead of touching anything if the user owns objects or holds
+	// privileges, even with ReassignTo or DropOwned set
+	RefuseIfDependencies bool
+}
+
+const userDependenciesQuery = `
+	SELECT pg_catalog.pg_describe_object(classid, objid, objsubid), deptype::text
+	FROM pg_shdepend
+	WHERE refclassid = 'pg_authid'::regclass
+	AND refobjid = (SELECT oid FROM pg_roles WHERE rolname = $1)
+`
+
+// PreviewUserDependencies lists what refers to username, per database, based on pg_shdepend.
+func (c *PostgresController) PreviewUserDependencies(username string) ([]UserDependency, error) {
+	if err := validateUsername(username); err != nil {
+		return nil, err
+	}
+
+	if exists, err := c.UserExists(username); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, ErrUserDoesNotExist
+	}
+
+	// Shared objects can be described from any database
+	deps, err := queryUserDependencies(c.db, "", userDependenciesQuery+" AND dbid = 0", username)
+	if err != nil {
+		return nil, err
+	}
+
+	databases, err := c.userDependencyDatabases(username)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dbName := range databases {
+		db, err := c.openDB(dbName)
+		if err != nil {
+			return nil, err
+		}
+
+		dbDeps, err := queryUserDependencies(db, dbName, userDependenciesQuery+`
+			AND dbid = (SELECT oid FROM pg_database WHERE datname = current_database())`, username)
+		db.Close()
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, dbDeps...)
+	}
+
+	return deps, nil
+}
+
+// DeleteUserWithOptions drops username after cleaning up every database it
+// has dependencies in, unlike DeleteUser which only cleans the connected one.
+// The user is switched to NOLOGIN and its sessions are terminated before
+// anything is checked, so it can't create objects while it is cleaned up.
+// LOGIN is given back if the user isn't dropped.
+func (c *PostgresController) DeleteUserWithOptions(username string, opts DeleteUserOptions) (err error) {
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+	if opts.ReassignTo != "" {
+		if opts.ReassignTo == username {
+			return fmt.Errorf("cannot reassign objects of %s to itself", username)
+		}
+		if exists, err := c.UserExists(opts.ReassignTo); err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("error checking successor %s: %w", opts.ReassignTo, ErrUserDoesNotExist)
+		}
+	}
+	refuse := opts.RefuseIfDependencies || (opts.ReassignTo == "" && !opts.DropOwned)
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	var canLogin bool
+	err = c.db.QueryRow(`SELECT rolcanlogin FROM pg_roles WHERE rolname = $1`, username).Scan(&canLogin)
+	if err == sql.ErrNoRows {
+		return ErrUserDoesNotExist
+	}
+	if err != nil {
+		return fmt.Errorf("error checking user: %w", err)
+	}
+	if canLogin {
+		_, err = c.db.Exec(fmt.Sprintf(`ALTER ROLE "%s" NOLOGIN`, username))
+		if err != nil {
+			return fmt.Errorf("error disabling login: %w", err)
+		}
+		defer func() {
+			if err != nil {
+				_, loginErr := c.db.Exec(fmt.Sprintf(`ALTER ROLE "%s" LOGIN`, username))
+				if loginErr != nil {
+					err = errors.Join(err, fmt.Errorf("error restoring login: %w", loginErr))
+				}
+			}
+		}()
+	}
+
+	err = c.terminateUserConnections(username)
+	if err != nil {
+		return err
+	}
+
+	if opts.ReassignTo == "" {
+		owned, err := queryStrings(c.db, `
+			SELECT datname FROM pg_database
+			WHERE datdba = (SELECT oid FROM pg_roles WHERE rolname = $1)
+			ORDER BY datname
+		`, username)
+		if err != nil {
+			return fmt.Errorf("error listing owned databases: %w", err)
+		}
+		if len(owned) > 0 {
+			return fmt.Errorf("%w: %s", ErrUserOwnsDatabases, strings.Join(owned, ", "))
+		}
+	}
+
+	deps, err := c.PreviewUserDependencies(username)
+	if err != nil {
+		return err
+	}
+	if refuse && len(deps) > 0 {
+		return fmt.Errorf("%w: %d objects", ErrUserHasDependencies, len(deps))
+	}
+
+	// REASSIGN OWNED also covers shared objects, which need a pass in any database
+	databases := map[string]bool{}
+	for _, dep := range deps {
+		dbName := dep.Database
+		if dbName == "" {
+			dbName = c.pc.Database
+		}
+		databases[dbName] = true
+	}
+
+	for dbName := range databases {
+		if err = c.cleanupUserObjects(dbName, username, opts.ReassignTo); err != nil {
+			return err
+		}
+	}
+
+	_, err = c.db.Exec(fmt.Sprintf(`DROP ROLE "%s"`, username))
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			return ErrUserDoesNotExist
+		}
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+
+	return nil
+}
+
+// cleanupUserObjects reassigns and drops what username owns in dbName.
+// Databases closed for connections, e.g. archived ones, are opened for the
+// duration of the cleanup.
+func (c *PostgresController) cleanupUserObjects(dbName, username, successor string) (err error) {
+	allowConn, err := c.databaseAllowsConnections(dbName)
+	if err != nil {
+		return err
+	}
+	if !allowConn {
+		if err := c.setAllowConnections(dbName, true); err != nil {
+			return err
+		}
+		defer func() {
+			err = errors.Join(err, c.setAllowConnections(dbName, false))
+		}()
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if successor != "" {
+		_, err = db.Exec(fmt.Sprintf(`REASSIGN OWNED BY "%s" TO "%s"`, username, successor))
+		if err != nil {
+			return fmt.Errorf("error reassigning owned objects in %s: %w", dbName, err)
+		}
+	}
+
+	// Drops whatever is left and revokes privileges
+	_, err = db.Exec(fmt.Sprintf(`DROP OWNED BY "%s"`, username))
+	if err != nil {
+		return fmt.Errorf("error dropping owned objects in %s: %w", dbName, err)
+	}
+
+	return nil
+}
+
+func (c *PostgresController) userDependencyDatabases(username string) ([]string, error) {
+	rows, err := c.db.Query(`
+		SELECT DISTINCT d.datname
+		FROM pg_shdepend s
+		JOIN pg_database d ON d.oid = s.dbid
+		WHERE s.refclassid = 'pg_authid'::regclass
+		AND s.refobjid = (SELECT oid FROM pg_roles WHERE rolname = $1)
+		ORDER BY 1
+	`, username)
+	if err != nil {
+		return nil, fmt.Errorf("error listing dependent databases: %w", err)
+	}
+	defer rows.Close()
+
+	var databases []string
+	for rows.Next() {
+		var dbName string
+		if err := rows.Scan(&dbName); err != nil {
+			return nil, fmt.Errorf("error scanning dependent database: %w", err)
+		}
+		databases = append(databases, dbName)
+	}
+
+	return databases, rows.Err()
+}
+
+func queryUserDependencies(db *sql.DB, dbName, query, username string) ([]UserDependency, error) {
+	rows, err := db.Query(query, username)
+	if err != nil {
+		return nil, fmt.Errorf("error listing user dependencies: %w", err)
+	}
+	defer rows.Close()
+
+	var deps []UserDependency
+	for rows.Next() {
+		var dep UserDependency
+		var deptype string
+		if err := rows.Scan(&dep.Object, &deptype); err != nil {
+			return nil, fmt.Errorf("error scanning user dependency: %w", err)
+		}
+		dep.Database = dbName
+		dep.Type = dependencyTypes[deptype]
+		if dep.Type == "" {
+			dep.Type = DependencyType(deptype)
+		}
+		deps = append(deps, dep)
+	}
+
+	return deps, rows.Err()
+}
+
+// ownedObjectsQuery lists objects owned by $1 along with the statement that
+// hands them over to $2. Sequences owned by a column and extension members
+// follow their parent object and are skipped.
+const ownedObjectsQuery = `
+	WITH role AS (SELECT oid FROM pg_roles WHERE rolname = $1)
+	SELECT 'schema', n.nspname, '', format('ALTER SCHEMA %I OWNER TO %I', n.nspname, $2::text)
+	FROM pg_namespace n
+	WHERE n.nspowner = (SELECT oid FROM role)
+	AND n.nspname NOT LIKE 'pg\_%'
+	AND n.nspname <> 'information_schema'
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_namespace'::regclass AND d.objid = n.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT k.kind, n.nspname, c.relname, format('ALTER %s %I.%I OWNER TO %I', k.keyword, n.nspname, c.relname, $2::text)
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	JOIN (VALUES
+		('r', 'table', 'TABLE'),
+		('p', 'partitioned table', 'TABLE'),
+		('v', 'view', 'VIEW'),
+		('m', 'materialized view', 'MATERIALIZED VIEW'),
+		('S', 'sequence', 'SEQUENCE'),
+		('f', 'foreign table', 'FOREIGN TABLE')
+	) AS k(relkind, kind, keyword) ON k.relkind = c.relkind::text
+	WHERE c.relowner = (SELECT oid FROM role)
+	AND n.nspname NOT LIKE 'pg\_%'
+	AND n.nspname <> 'information_schema'
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid
+		AND (d.deptype = 'e' OR (c.relkind = 'S' AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a', 'i')))
+	)
+	UNION ALL
+	SELECT CASE p.prokind WHEN 'p' THEN 'procedure' WHEN 'a' THEN 'aggregate' ELSE 'function' END,
+		n.nspname, p.oid::regprocedure::text, format('ALTER ROUTINE %s OWNER TO %I', p.oid::regprocedure, $2::text)
+	FROM pg_proc p
+	JOIN pg_namespace n ON n.oid = p.pronamespace
+	WHERE p.proowner = (SELECT oid FROM role)
+	AND n.nspname NOT LIKE 'pg\_%'
+	AND n.nspname <> 'information_schema'
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT CASE t.typtype WHEN 'd' THEN 'domain' ELSE 'type' END,
+		n.nspname, t.typname,
+		format('ALTER %s %I.%I OWNER TO %I', CASE t.typtype WHEN 'd' THEN 'DOMAIN' ELSE 'TYPE' END, n.nspname, t.typname, $2::text)
+	FROM pg_type t
+	JOIN pg_namespace n ON n.oid = t.typnamespace
+	LEFT JOIN pg_class c ON c.oid = t.typrelid
+	WHERE t.typowner = (SELECT oid FROM role)
+	AND (t.typtype IN ('e', 'd', 'r') OR (t.typtype = 'c' AND c.relkind = 'c'))
+	AND n.nspname NOT LIKE 'pg\_%'
+	AND n.nspname <> 'information_schema'
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_type'::regclass AND d.objid = t.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT 'operator', n.nspname, o.oid::regoperator::text, format('ALTER OPERATOR %s OWNER TO %I', o.oid::regoperator, $2::text)
+	FROM pg_operator o
+	JOIN pg_namespace n ON n.oid = o.oprnamespace
+	WHERE o.oprowner = (SELECT oid FROM role)
+	AND n.nspname NOT LIKE 'pg\_%'
+	AND n.nspname <> 'information_schema'
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_operator'::regclass AND d.objid = o.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT 'operator class', n.nspname, oc.opcname, format('ALTER OPERATOR CLASS %I.%I USING %I OWNER TO %I', n.nspname, oc.opcname, am.amname, $2::text)
+	FROM pg_opclass oc
+	JOIN pg_namespace n ON n.oid = oc.opcnamespace
+	JOIN pg_am am ON am.oid = oc.opcmethod
+	WHERE oc.opcowner = (SELECT oid FROM role)
+	AND n.nspname NOT LIKE 'pg\_%'
+	AND n.nspname <> 'information_schema'
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_opclass'::regclass AND d.objid = oc.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT 'operator family', n.nspname, of.opfname, format('ALTER OPERATOR FAMILY %I.%I USING %I OWNER TO %I', n.nspname, of.opfname, am.amname, $2::text)
+	FROM pg_opfamily of
+	JOIN pg_namespace n ON n.oid = of.opfnamespace
+	JOIN pg_am am ON am.oid = of.opfmethod
+	WHERE of.opfowner = (SELECT oid FROM role)
+	AND n.nspname NOT LIKE 'pg\_%'
+	AND n.nspname <> 'information_schema'
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_opfamily'::regclass AND d.objid = of.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT 'collation', n.nspname, co.collname, format('ALTER COLLATION %I.%I OWNER TO %I', n.nspname, co.collname, $2::text)
+	FROM pg_collation co
+	JOIN pg_namespace n ON n.oid = co.collnamespace
+	WHERE co.collowner = (SELECT oid FROM role)
+	AND n.nspname NOT LIKE 'pg\_%'
+	AND n.nspname <> 'information_schema'
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_collation'::regclass AND d.objid = co.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT 'conversion', n.nspname, cv.conname, format('ALTER CONVERSION %I.%I OWNER TO %I', n.nspname, cv.conname, $2::text)
+	FROM pg_conversion cv
+	JOIN pg_namespace n ON n.oid = cv.connamespace
+	WHERE cv.conowner = (SELECT oid FROM role)
+	AND n.nspname NOT LIKE 'pg\_%'
+	AND n.nspname <> 'information_schema'
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_conversion'::regclass AND d.objid = cv.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT 'text search configuration', n.nspname, tc.cfgname, format('ALTER TEXT SEARCH CONFIGURATION %I.%I OWNER TO %I', n.nspname, tc.cfgname, $2::text)
+	FROM pg_ts_config tc
+	JOIN pg_namespace n ON n.oid = tc.cfgnamespace
+	WHERE tc.cfgowner = (SELECT oid FROM role)
+	AND n.nspname NOT LIKE 'pg\_%'
+	AND n.nspname <> 'information_schema'
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_ts_config'::regclass AND d.objid = tc.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT 'text search dictionary', n.nspname, td.dictname, format('ALTER TEXT SEARCH DICTIONARY %I.%I OWNER TO %I', n.nspname, td.dictname, $2::text)
+	FROM pg_ts_dict td
+	JOIN pg_namespace n ON n.oid = td.dictnamespace
+	WHERE td.dictowner = (SELECT oid FROM role)
+	AND n.nspname NOT LIKE 'pg\_%'
+	AND n.nspname <> 'information_schema'
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_ts_dict'::regclass AND d.objid = td.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT 'statistics', n.nspname, st.stxname, format('ALTER STATISTICS %I.%I OWNER TO %I', n.nspname, st.stxname, $2::text)
+	FROM pg_statistic_ext st
+	JOIN pg_namespace n ON n.oid = st.stxnamespace
+	WHERE st.stxowner = (SELECT oid FROM role)
+	AND n.nspname NOT LIKE 'pg\_%'
+	AND n.nspname <> 'information_schema'
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_statistic_ext'::regclass AND d.objid = st.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT 'foreign data wrapper', '', w.fdwname, format('ALTER FOREIGN DATA WRAPPER %I OWNER TO %I', w.fdwname, $2::text)
+	FROM pg_foreign_data_wrapper w
+	WHERE w.fdwowner = (SELECT oid FROM role)
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_foreign_data_wrapper'::regclass AND d.objid = w.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT 'foreign server', '', fs.srvname, format('ALTER SERVER %I OWNER TO %I', fs.srvname, $2::text)
+	FROM pg_foreign_server fs
+	WHERE fs.srvowner = (SELECT oid FROM role)
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_foreign_server'::regclass AND d.objid = fs.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT 'publication', '', pub.pubname, format('ALTER PUBLICATION %I OWNER TO %I', pub.pubname, $2::text)
+	FROM pg_publication pub
+	WHERE pub.pubowner = (SELECT oid FROM role)
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_publication'::regclass AND d.objid = pub.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT 'subscription', '', sub.subname, format('ALTER SUBSCRIPTION %I OWNER TO %I', sub.subname, $2::text)
+	FROM pg_subscription sub
+	WHERE sub.subowner = (SELECT oid FROM role)
+	AND sub.subdbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+	UNION ALL
+	SELECT 'language', '', lan.lanname, format('ALTER LANGUAGE %I OWNER TO %I', lan.lanname, $2::text)
+	FROM pg_language lan
+	WHERE lan.lanowner = (SELECT oid FROM role)
+	AND lan.lanispl
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_language'::regclass AND d.objid = lan.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT 'event trigger', '', et.evtname, format('ALTER EVENT TRIGGER %I OWNER TO %I', et.evtname, $2::text)
+	FROM pg_event_trigger et
+	WHERE et.evtowner = (SELECT oid FROM role)
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d
+		WHERE d.classid = 'pg_event_trigger'::regclass AND d.objid = et.oid AND d.deptype = 'e'
+	)
+	UNION ALL
+	SELECT 'large object', '', l.oid::text, format('ALTER LARGE OBJECT %s OWNER TO %I', l.oid, $2::text)
+	FROM pg_largeobject_metadata l
+	WHERE l.lomowner = (SELECT oid FROM role)
+`
+
+// TransferAllOwnership hands every object fromRole owns in dbName over to
+// toRole: schemas, relations, routines, types, operators, collations, text
+// search objects, foreign data wrappers and servers, publications,
+// subscriptions, procedural languages, event triggers, large objects and the
+// database itself. Unlike REASSIGN OWNED it
+// leaves objects in other databases alone. The objects inside the database
+// are changed in a single transaction. fromRole may be a reserved user.
+func (c *PostgresController) TransferAllOwnership(dbName, fromRole, toRole string) (OwnershipReport, error) {
+	if err := validateDBName(dbName); err != nil {
+		return OwnershipReport{}, err
+	}
+	if err := validateUsername(toRole); err != nil {
+		return OwnershipReport{}, err
+	}
+	// Taking objects away from a reserved user such as postgres is fine
+	for _, role := range []string{fromRole, toRole} {
+		if exists, err := c.roleExists(role); err != nil {
+			return OwnershipReport{}, err
+		} else if !exists {
+			return OwnershipReport{}, fmt.Errorf("error checking %s: %w", role, ErrUserDoesNotExist)
+		}
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return OwnershipReport{}, err
+	}
+
+	var dbOwner string
+	err := c.db.QueryRow(`
+		SELECT pg_catalog.pg_get_userbyid(datdba) FROM pg_database
+		WHERE datname = $1
+	`, dbName).Scan(&dbOwner)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return OwnershipReport{}, ErrDBDoesNotExist
+		}
+		return OwnershipReport{}, fmt.Errorf("error getting database owner: %w", err)
+	}
+
+	report := OwnershipReport{Database: dbName, From: fromRole, To: toRole}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return OwnershipReport{}, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return OwnershipReport{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(ownedObjectsQuery, fromRole, toRole)
+	if err != nil {
+		return OwnershipReport{}, fmt.Errorf("error listing owned objects: %w", err)
+	}
+
+	var stmts []string
+	for rows.Next() {
+		var change OwnershipChange
+		var stmt string
+		if err := rows.Scan(&change.Kind, &change.Schema, &change.Name, &stmt); err != nil {
+			rows.Close()
+			return OwnershipReport{}, fmt.Errorf("error scanning owned object: %w", err)
+		}
+		report.Changes = append(report.Changes, change)
+		stmts = append(stmts, stmt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return OwnershipReport{}, err
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return OwnershipReport{}, fmt.Errorf("error transferring ownership (%s): %w", stmt, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return OwnershipReport{}, fmt.Errorf("error committing ownership transfer: %w", err)
+	}
+
+	if dbOwner == fromRole {
+		if err := c.transferDatabaseOwnership(dbName, toRole); err != nil {
+			return report, fmt.Errorf("error transferring database ownership: %w", err)
+		}
+		report.Changes = append(report.Changes, OwnershipChange{Kind: "database", Name: dbName})
+	}
+
+	return report, nil
+}
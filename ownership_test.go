@@ -0,0 +1,208 @@
+// postgresctl/ownership_test.go
+package postgresctl
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresController_DeleteUserWithOptions(t *testing.T) {
+	firstDB := testDB()
+	secondDB := testDB()
+	testUser := testUser()
+	successor := testUser + "_successor"
+	testPassword := testPassword()
+
+	c := createTestController()
+	defer c.Close()
+
+	_, err := c.PreviewUserDependencies(testUser)
+	assert.Equal(t, ErrUserDoesNotExist, err)
+
+	err = c.CreateUser(testUser, testPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	err = c.CreateUser(successor, testPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUser(successor)
+
+	deps, err := c.PreviewUserDependencies(testUser)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(deps))
+
+	for _, dbName := range []string{firstDB, secondDB} {
+		err = c.CreateDatabase(dbName)
+		assert.NoError(t, err)
+		defer c.DeleteDatabase(dbName)
+	}
+
+	// The user owns a table in the first database
+	admin, err := c.openDB(firstDB)
+	assert.NoError(t, err)
+	_, err = admin.Exec(fmt.Sprintf(`GRANT CREATE ON SCHEMA public TO "%s"`, testUser))
+	assert.NoError(t, err)
+	admin.Close()
+
+	db, err := sql.Open("postgres", fmt.Sprintf("postgres://%s:%s@localhost:55432/%s?sslmode=disable", testUser, testPassword, firstDB))
+	assert.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE owned_table (id INT)`)
+	assert.NoError(t, err)
+	db.Close()
+
+	// and holds a privilege in the second one
+	admin, err = c.openDB(secondDB)
+	assert.NoError(t, err)
+	_, err = admin.Exec(fmt.Sprintf(`CREATE TABLE shared_table (id INT); GRANT SELECT ON shared_table TO "%s"`, testUser))
+	assert.NoError(t, err)
+	admin.Close()
+
+	deps, err = c.PreviewUserDependencies(testUser)
+	assert.NoError(t, err)
+	assert.Contains(t, deps, UserDependency{Database: firstDB, Object: "table owned_table", Type: DependencyOwner})
+	assert.Contains(t, deps, UserDependency{Database: secondDB, Object: "table shared_table", Type: DependencyPrivilege})
+
+	err = c.DeleteUserWithOptions(testUser, DeleteUserOptions{RefuseIfDependencies: true})
+	assert.ErrorIs(t, err, ErrUserHasDependencies)
+
+	// Nothing is dropped unless asked for
+	err = c.DeleteUserWithOptions(testUser, DeleteUserOptions{})
+	assert.ErrorIs(t, err, ErrUserHasDependencies)
+
+	exists, err := c.UserExists(testUser)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	err = openPostgres(testUser, testPassword, firstDB)
+	assert.NoError(t, err, "a refused user should be able to log in again")
+
+	err = c.DeleteUserWithOptions(testUser, DeleteUserOptions{ReassignTo: testUser})
+	assert.Error(t, err)
+
+	// Databases closed for connections are cleaned up as well
+	err = c.setAllowConnections(secondDB, false)
+	assert.NoError(t, err)
+
+	err = c.DeleteUserWithOptions(testUser, DeleteUserOptions{ReassignTo: successor})
+	assert.NoError(t, err)
+
+	allowConn, err := c.databaseAllowsConnections(secondDB)
+	assert.NoError(t, err)
+	assert.False(t, allowConn)
+
+	exists, err = c.UserExists(testUser)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// The table survived and belongs to the successor
+	admin, err = c.openDB(firstDB)
+	assert.NoError(t, err)
+	defer admin.Close()
+
+	var owner string
+	err = admin.QueryRow(`SELECT tableowner FROM pg_tables WHERE tablename = 'owned_table'`).Scan(&owner)
+	assert.NoError(t, err)
+	assert.Equal(t, successor, owner)
+
+	// Databases aren't dropped with their owner
+	err = c.TransferDatabaseOwnership(firstDB, successor)
+	assert.NoError(t, err)
+	err = c.DeleteUserWithOptions(successor, DeleteUserOptions{DropOwned: true})
+	assert.ErrorIs(t, err, ErrUserOwnsDatabases)
+
+	err = c.DeleteUserWithOptions("", DeleteUserOptions{})
+	assert.Error(t, err)
+
+	for _, name := range baseUsers {
+		err = c.DeleteUserWithOptions(name, DeleteUserOptions{})
+		assert.Error(t, err)
+	}
+}
+
+func TestPostgresController_TransferAllOwnership(t *testing.T) {
+	testDB := testDB()
+	otherDB := testDB + "_other"
+	fromUser := testUser()
+	toUser := fromUser + "_to"
+
+	c := createTestController()
+	defer c.Close()
+
+	for _, name := range []string{fromUser, toUser} {
+		err := c.CreateUser(name, testPassword())
+		assert.NoError(t, err)
+		defer c.DeleteUserWithOptions(name, DeleteUserOptions{DropOwned: true})
+	}
+
+	_, err := c.TransferAllOwnership(testDB, fromUser, toUser)
+	assert.Equal(t, ErrDBDoesNotExist, err)
+
+	for _, name := range []string{testDB, otherDB} {
+		err = c.CreateDatabase(name)
+		assert.NoError(t, err)
+		defer c.DeleteDatabase(name)
+
+		err = c.TransferDatabaseOwnership(name, fromUser)
+		assert.NoError(t, err)
+	}
+
+	db, err := c.openDB(testDB)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(fmt.Sprintf(`
+		CREATE SCHEMA app AUTHORIZATION "%[1]s";
+		CREATE LANGUAGE plcopy HANDLER plpgsql_call_handler;
+		ALTER LANGUAGE plcopy OWNER TO "%[1]s";
+		SET ROLE "%[1]s";
+		CREATE TABLE app.items (id SERIAL PRIMARY KEY);
+		CREATE VIEW app.items_view AS SELECT * FROM app.items;
+		CREATE SEQUENCE app.counter;
+		CREATE FUNCTION app.answer() RETURNS INT AS 'SELECT 42' LANGUAGE sql;
+		CREATE TYPE app.mood AS ENUM ('ok', 'meh');
+		CREATE DOMAIN app.positive AS INT CHECK (VALUE > 0);
+		CREATE COLLATION app.plain (provider = libc, locale = 'C');
+		CREATE TEXT SEARCH CONFIGURATION app.search (COPY = pg_catalog.simple);
+		CREATE PUBLICATION items_pub FOR TABLE app.items;
+		RESET ROLE;
+	`, fromUser))
+	assert.NoError(t, err)
+
+	report, err := c.TransferAllOwnership(testDB, fromUser, toUser)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []OwnershipChange{
+		{Kind: "schema", Schema: "app", Name: ""},
+		{Kind: "table", Schema: "app", Name: "items"},
+		{Kind: "view", Schema: "app", Name: "items_view"},
+		{Kind: "sequence", Schema: "app", Name: "counter"},
+		{Kind: "function", Schema: "app", Name: "app.answer()"},
+		{Kind: "type", Schema: "app", Name: "mood"},
+		{Kind: "domain", Schema: "app", Name: "positive"},
+		{Kind: "collation", Schema: "app", Name: "plain"},
+		{Kind: "text search configuration", Schema: "app", Name: "search"},
+		{Kind: "publication", Schema: "", Name: "items_pub"},
+		{Kind: "language", Schema: "", Name: "plcopy"},
+		{Kind: "database", Schema: "", Name: testDB},
+	}, report.Changes)
+
+	var leftovers int
+	err = db.QueryRow(`
+		SELECT count(*) FROM pg_class
+		WHERE relowner = (SELECT oid FROM pg_roles WHERE rolname = $1)
+	`, fromUser).Scan(&leftovers)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, leftovers)
+
+	// Reserved users can hand their objects over too
+	_, err = c.TransferAllOwnership(otherDB, pc.Username, toUser)
+	assert.NoError(t, err)
+
+	// Other databases are left alone
+	var owner string
+	err = c.db.QueryRow(`SELECT pg_catalog.pg_get_userbyid(datdba) FROM pg_database WHERE datname = $1`, otherDB).Scan(&owner)
+	assert.NoError(t, err)
+	assert.Equal(t, fromUser, owner)
+}
@@ -0,0 +1,124 @@
+// postgresctl/predefinedroles.go
+package postgresctl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PredefinedRoleController grants the built-in pg_* roles, e.g. pg_monitor
+// to a metrics exporter or pg_read_all_data to a backup user.
+type PredefinedRoleController interface {
+	GrantPredefinedRole(username, role string) error
+	RevokePredefinedRole(username, role string) error
+	PredefinedRoles() ([]string, error)
+}
+
+var _ PredefinedRoleController = &PostgresController{}
+
+var (
+	ErrInvalidPredefinedRole = fmt.Errorf("invalid predefined role")
+)
+
+// Predefined roles that can be granted and the version adding them.
+// pg_database_owner is left out, its membership is implicit.
+var predefinedRoles = map[string]int{
+	"pg_signal_backend":           0,
+	"pg_monitor":                  0,
+	"pg_read_all_settings":        0,
+	"pg_read_all_stats":           0,
+	"pg_stat_scan_tables":         0,
+	"pg_read_server_files":        0,
+	"pg_write_server_files":       0,
+	"pg_execute_server_program":   0,
+	"pg_read_all_data":            postgres14,
+	"pg_write_all_data":           postgres14,
+	"pg_checkpoint":               postgres15,
+	"pg_use_reserved_connections": postgres16,
+	"pg_create_subscription":      postgres16,
+	"pg_maintain":                 postgres17,
+	"pg_signal_autovacuum_worker": postgres18,
+}
+
+// GrantPredefinedRole makes username a member of role. Since PostgreSQL 16
+// the membership is granted WITH INHERIT TRUE so it also applies to roles
+// created with NOINHERIT.
+func (c *PostgresController) GrantPredefinedRole(username, role string) error {
+	if err := c.validatePredefinedRole(role); err != nil {
+		return err
+	}
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	caps, err := c.Capabilities()
+	if err != nil {
+		return err
+	}
+	stmt := "GRANT " + quoteIdent(role) + " TO " + quoteIdent(username)
+	if caps.GrantWithInherit {
+		stmt += " WITH INHERIT TRUE"
+	}
+
+	if _, err := c.db.Exec(stmt); err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			return ErrUserDoesNotExist
+		}
+		return fmt.Errorf("error granting %s: %w", role, err)
+	}
+	return nil
+}
+
+func (c *PostgresController) RevokePredefinedRole(username, role string) error {
+	if err := c.validatePredefinedRole(role); err != nil {
+		return err
+	}
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	if _, err := c.db.Exec("REVOKE " + quoteIdent(role) + " FROM " + quoteIdent(username)); err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			return ErrUserDoesNotExist
+		}
+		return fmt.Errorf("error revoking %s: %w", role, err)
+	}
+	return nil
+}
+
+// PredefinedRoles lists the roles GrantPredefinedRole accepts on this server
+func (c *PostgresController) PredefinedRoles() ([]string, error) {
+	caps, err := c.Capabilities()
+	if err != nil {
+		return nil, err
+	}
+	return predefinedRolesFor(caps.VersionNum), nil
+}
+
+func predefinedRolesFor(versionNum int) []string {
+	var roles []string
+	for role, minVersionNum := range predefinedRoles {
+		if versionNum >= minVersionNum {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+func (c *PostgresController) validatePredefinedRole(role string) error {
+	minVersionNum, ok := predefinedRoles[role]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrInvalidPredefinedRole, role)
+	}
+	return c.requireVersion(role, minVersionNum)
+}
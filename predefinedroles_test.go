@@ -0,0 +1,77 @@
+// postgresctl/predefinedroles_test.go
+package postgresctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPredefinedRolesFor(t *testing.T) {
+	roles := predefinedRolesFor(120019)
+	assert.Contains(t, roles, "pg_monitor")
+	assert.Contains(t, roles, "pg_signal_backend")
+	assert.NotContains(t, roles, "pg_read_all_data")
+	assert.NotContains(t, roles, "pg_database_owner")
+
+	roles = predefinedRolesFor(170000)
+	assert.Contains(t, roles, "pg_read_all_data")
+	assert.Contains(t, roles, "pg_maintain")
+	assert.NotContains(t, roles, "pg_signal_autovacuum_worker")
+}
+
+func TestPostgresController_GrantPredefinedRole(t *testing.T) {
+	testUser := testUser()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.GrantPredefinedRole(testUser, "pg_monitor")
+	assert.Equal(t, ErrUserDoesNotExist, err)
+
+	err = c.CreateUser(testUser, testPassword())
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	err = c.GrantPredefinedRole(testUser, "pg_superuser")
+	assert.ErrorIs(t, err, ErrInvalidPredefinedRole)
+	err = c.GrantPredefinedRole(testUser, "pg_database_owner")
+	assert.ErrorIs(t, err, ErrInvalidPredefinedRole)
+
+	roles, err := c.PredefinedRoles()
+	assert.NoError(t, err)
+	assert.Contains(t, roles, "pg_monitor")
+
+	caps, err := c.Capabilities()
+	assert.NoError(t, err)
+	err = c.GrantPredefinedRole(testUser, "pg_maintain")
+	if caps.VersionNum < postgres17 {
+		assert.ErrorIs(t, err, ErrUnsupportedByServer)
+	} else {
+		assert.NoError(t, err)
+	}
+
+	err = c.GrantPredefinedRole(testUser, "pg_monitor")
+	assert.NoError(t, err)
+	err = c.GrantPredefinedRole(testUser, "pg_signal_backend")
+	assert.NoError(t, err)
+
+	info, err := c.DescribeUser(testUser)
+	assert.NoError(t, err)
+	assert.True(t, info.CanLogin)
+	assert.False(t, info.Superuser)
+	assert.Empty(t, info.MemberOf)
+	assert.Contains(t, info.PredefinedRoles, "pg_monitor")
+	assert.Contains(t, info.PredefinedRoles, "pg_signal_backend")
+
+	err = c.RevokePredefinedRole(testUser, "pg_monitor")
+	assert.NoError(t, err)
+
+	info, err = c.DescribeUser(testUser)
+	assert.NoError(t, err)
+	assert.NotContains(t, info.PredefinedRoles, "pg_monitor")
+	assert.Contains(t, info.PredefinedRoles, "pg_signal_backend")
+
+	_, err = c.DescribeUser("no_such_user")
+	assert.Equal(t, ErrUserDoesNotExist, err)
+}
@@ -0,0 +1,380 @@
+// postgresctl/privilegereport.go
+package postgresctl
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrivilegeReporter answers "who can do what on which database"
+type PrivilegeReporter interface {
+	PrivilegeReport(opts PrivilegeReportOptions) (*PrivilegeReport, error)
+}
+
+var _ PrivilegeReporter = &PostgresController{}
+
+type PrivilegeReportOptions struct {
+	// Databases defaults to every database except templates, base and
+	// archived databases
+	Databases []string
+	// Users defaults to every login role, as in ListUsers
+	Users []string
+}
+
+// PrivilegeReport is a user × object × privilege matrix. Superusers bypass
+// privilege checks, they are listed in Superusers instead of getting an
+// entry for every object.
+type PrivilegeReport struct {
+	GeneratedAt   time.Time `json:"generated_at"`
+	ServerVersion string    `json:"server_version"`
+	Databases     []string  `json:"databases"`
+	// SkippedDatabases don't allow connections, their privileges aren't
+	// listed
+	SkippedDatabases []string `json:"skipped_databases,omitempty"`
+	// Users are the users the report was limited to, empty means every
+	// login role
+	Users      []string               `json:"users,omitempty"`
+	Superusers []string               `json:"superusers"`
+	Entries    []PrivilegeReportEntry `json:"entries"`
+}
+
+type PrivilegeReportEntry struct {
+	User       string     `json:"user"`
+	Database   string     `json:"database"`
+	ObjectType ObjectType `json:"object_type"`
+	Schema     string     `json:"schema,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	Column     string     `json:"column,omitempty"`
+	Privilege  Privilege  `json:"privilege"`
+	Grantable  bool       `json:"grantable"`
+	// Via is the role holding the privilege: the user itself, a role the
+	// user inherits privileges from, or PUBLIC
+	Via string `json:"via"`
+}
+
+// PrivilegeReportDiff lists what changed between two reports. An entry
+// whose Via or Grantable changed is both removed and added. Only users
+// covered by both reports are compared.
+type PrivilegeReportDiff struct {
+	Added             []PrivilegeReportEntry `json:"added"`
+	Removed           []PrivilegeReportEntry `json:"removed"`
+	AddedSuperusers   []string               `json:"added_superusers"`
+	RemovedSuperusers []string               `json:"removed_superusers"`
+}
+
+// reportedPredefinedRoles hold privileges on every object of a kind without
+// showing up in ACLs, their members get entries for every such object
+var reportedPredefinedRoles = map[string]map[ObjectType][]Privilege{
+	"pg_read_all_data": {
+		ObjectTypeSchema:   {PrivilegeUsage},
+		ObjectTypeTable:    {PrivilegeSelect},
+		ObjectTypeSequence: {PrivilegeSelect},
+	},
+	"pg_write_all_data": {
+		ObjectTypeSchema:   {PrivilegeUsage},
+		ObjectTypeTable:    {PrivilegeInsert, PrivilegeUpdate, PrivilegeDelete},
+		ObjectTypeSequence: {PrivilegeUpdate},
+	},
+	"pg_maintain": {
+		ObjectTypeTable: {PrivilegeMaintain},
+	},
+}
+
+var privilegeReportHeader = []string{"user", "database", "object_type", "schema", "name", "column", "privilege", "grantable", "via"}
+
+// PrivilegeReport lists the privileges of users in every database, direct
+// ones as well as those inherited through role membership and PUBLIC.
+// Ownership is covered through the owner's implicit privileges, members of
+// pg_read_all_data, pg_write_all_data and pg_maintain get an entry per
+// object with the predefined role as Via.
+func (c *PostgresController) PrivilegeReport(opts PrivilegeReportOptions) (*PrivilegeReport, error) {
+	caps, err := c.Capabilities()
+	if err != nil {
+		return nil, err
+	}
+
+	databases := opts.Databases
+	if len(databases) == 0 {
+		infos, err := c.DescribeDatabases(DescribeDatabasesOptions{SortBy: SortDatabasesByName})
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			databases = append(databases, info.Name)
+		}
+	}
+
+	users := opts.Users
+	if len(users) == 0 {
+		users, err = c.ListUsers()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := &PrivilegeReport{
+		GeneratedAt:   time.Now().UTC(),
+		ServerVersion: caps.Version,
+		Users:         opts.Users,
+	}
+
+	// roles[user] are the roles whose privileges user has, the user included
+	roles := map[string][]string{}
+	for _, user := range users {
+		var superuser bool
+		err := c.db.QueryRow(`SELECT rolsuper FROM pg_roles WHERE rolname = $1`, user).Scan(&superuser)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrUserDoesNotExist, user)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error describing user %s: %w", user, err)
+		}
+		if superuser {
+			report.Superusers = append(report.Superusers, user)
+			continue
+		}
+
+		inherited, err := queryStrings(c.db, `
+			SELECT r.rolname FROM pg_roles r, pg_roles u
+			WHERE u.rolname = $1 AND pg_catalog.pg_has_role(u.oid, r.oid, 'USAGE')
+		`, user)
+		if err != nil {
+			return nil, fmt.Errorf("error listing roles of %s: %w", user, err)
+		}
+		roles[user] = append(inherited, "PUBLIC")
+	}
+
+	for _, dbName := range databases {
+		allowConn, err := c.databaseAllowsConnections(dbName)
+		if err != nil {
+			return nil, err
+		}
+		if !allowConn {
+			report.SkippedDatabases = append(report.SkippedDatabases, dbName)
+			continue
+		}
+		report.Databases = append(report.Databases, dbName)
+
+		privileges, err := c.ListPrivileges(dbName)
+		if err != nil {
+			return nil, fmt.Errorf("error listing privileges of %s: %w", dbName, err)
+		}
+
+		byGrantee := map[string][]PrivilegeEntry{}
+		for _, p := range privileges {
+			byGrantee[p.Grantee] = append(byGrantee[p.Grantee], p)
+		}
+		for role, kinds := range reportedPredefinedRoles {
+			byGrantee[role] = predefinedRolePrivileges(role, privileges, kinds)
+		}
+
+		for user, via := range roles {
+			for _, role := range via {
+				for _, p := range byGrantee[role] {
+					report.Entries = append(report.Entries, PrivilegeReportEntry{
+						User:       user,
+						Database:   dbName,
+						ObjectType: p.Target.Type,
+						Schema:     p.Target.Schema,
+						Name:       p.Target.Name,
+						Column:     p.Column,
+						Privilege:  p.Privilege,
+						Grantable:  p.Grantable,
+						Via:        role,
+					})
+				}
+			}
+		}
+	}
+
+	sort.Strings(report.Superusers)
+	report.Entries = uniquePrivilegeReportEntries(report.Entries)
+	return report, nil
+}
+
+// ReadPrivilegeReport reads a report written by WriteJSON, e.g. an older
+// snapshot to diff against
+func ReadPrivilegeReport(r io.Reader) (*PrivilegeReport, error) {
+	var report PrivilegeReport
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, fmt.Errorf("error reading privilege report: %w", err)
+	}
+	return &report, nil
+}
+
+func (r *PrivilegeReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes the entries with a header row, superusers aren't included
+func (r *PrivilegeReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(privilegeReportHeader); err != nil {
+		return err
+	}
+	for _, e := range r.Entries {
+		if err := cw.Write(e.fields()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (r *PrivilegeReport) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# Privilege report\n\n")
+	fmt.Fprintf(&b, "Generated at %s on PostgreSQL %s.\n\n", r.GeneratedAt.Format(time.RFC3339), r.ServerVersion)
+	if len(r.Users) > 0 {
+		fmt.Fprintf(&b, "Limited to users: %s.\n\n", strings.Join(r.Users, ", "))
+	}
+	if len(r.SkippedDatabases) > 0 {
+		fmt.Fprintf(&b, "Skipped databases not allowing connections: %s.\n\n", strings.Join(r.SkippedDatabases, ", "))
+	}
+	if len(r.Superusers) > 0 {
+		fmt.Fprintf(&b, "Superusers, holding every privilege: %s.\n\n", strings.Join(r.Superusers, ", "))
+	}
+	writeMarkdownEntries(&b, r.Entries)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// DiffPrivilegeReports returns what changed from before to after
+func DiffPrivilegeReports(before, after *PrivilegeReport) PrivilegeReportDiff {
+	var diff PrivilegeReportDiff
+
+	covered := func(user string) bool {
+		return before.covers(user) && after.covers(user)
+	}
+
+	beforeEntries := map[PrivilegeReportEntry]bool{}
+	for _, e := range before.Entries {
+		beforeEntries[e] = true
+	}
+	afterEntries := map[PrivilegeReportEntry]bool{}
+	for _, e := range after.Entries {
+		afterEntries[e] = true
+		if !beforeEntries[e] && covered(e.User) {
+			diff.Added = append(diff.Added, e)
+		}
+	}
+	for _, e := range before.Entries {
+		if !afterEntries[e] && covered(e.User) {
+			diff.Removed = append(diff.Removed, e)
+		}
+	}
+
+	for _, user := range after.Superusers {
+		if !contains(before.Superusers, user) && covered(user) {
+			diff.AddedSuperusers = append(diff.AddedSuperusers, user)
+		}
+	}
+	for _, user := range before.Superusers {
+		if !contains(after.Superusers, user) && covered(user) {
+			diff.RemovedSuperusers = append(diff.RemovedSuperusers, user)
+		}
+	}
+
+	return diff
+}
+
+// covers reports whether user was included in the report
+func (r *PrivilegeReport) covers(user string) bool {
+	return len(r.Users) == 0 || contains(r.Users, user)
+}
+
+func (d PrivilegeReportDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.AddedSuperusers) == 0 && len(d.RemovedSuperusers) == 0
+}
+
+func (d PrivilegeReportDiff) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# Privilege changes\n\n")
+	if d.Empty() {
+		b.WriteString("No changes.\n")
+	}
+	if len(d.AddedSuperusers) > 0 {
+		fmt.Fprintf(&b, "New superusers: %s.\n\n", strings.Join(d.AddedSuperusers, ", "))
+	}
+	if len(d.RemovedSuperusers) > 0 {
+		fmt.Fprintf(&b, "No longer superusers: %s.\n\n", strings.Join(d.RemovedSuperusers, ", "))
+	}
+	if len(d.Added) > 0 {
+		b.WriteString("## Added\n\n")
+		writeMarkdownEntries(&b, d.Added)
+		b.WriteString("\n")
+	}
+	if len(d.Removed) > 0 {
+		b.WriteString("## Removed\n\n")
+		writeMarkdownEntries(&b, d.Removed)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMarkdownEntries(b *strings.Builder, entries []PrivilegeReportEntry) {
+	b.WriteString("| " + strings.Join(privilegeReportHeader, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(privilegeReportHeader)) + "\n")
+	for _, e := range entries {
+		fields := e.fields()
+		for i, field := range fields {
+			fields[i] = strings.ReplaceAll(field, "|", `\|`)
+		}
+		b.WriteString("| " + strings.Join(fields, " | ") + " |\n")
+	}
+}
+
+func (e PrivilegeReportEntry) fields() []string {
+	return []string{e.User, e.Database, string(e.ObjectType), e.Schema, e.Name, e.Column, string(e.Privilege), strconv.FormatBool(e.Grantable), e.Via}
+}
+
+// predefinedRolePrivileges grants role the privileges in kinds on every
+// object listed in privileges
+func predefinedRolePrivileges(role string, privileges []PrivilegeEntry, kinds map[ObjectType][]Privilege) []PrivilegeEntry {
+	var entries []PrivilegeEntry
+	seen := map[Target]bool{}
+	for _, p := range privileges {
+		if p.Column != "" || seen[p.Target] {
+			continue
+		}
+		seen[p.Target] = true
+		for _, privilege := range kinds[p.Target.Type] {
+			entries = append(entries, PrivilegeEntry{Grantee: role, Privilege: privilege, Target: p.Target})
+		}
+	}
+	return entries
+}
+
+// uniquePrivilegeReportEntries sorts entries and drops duplicates, which
+// come from the same privilege being granted by several grantors
+func uniquePrivilegeReportEntries(entries []PrivilegeReportEntry) []PrivilegeReportEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].fields(), entries[j].fields()
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+
+	var unique []PrivilegeReportEntry
+	for i, e := range entries {
+		if i > 0 && e == entries[i-1] {
+			continue
+		}
+		unique = append(unique, e)
+	}
+	return unique
+}
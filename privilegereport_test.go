@@ -0,0 +1,208 @@
+// postgresctl/privilegereport_test.go
+package postgresctl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrivilegeReport_Export(t *testing.T) {
+	report := &PrivilegeReport{
+		GeneratedAt:   time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		ServerVersion: "16.4",
+		Databases:     []string{"shop"},
+		Superusers:    []string{"admin"},
+		Entries: []PrivilegeReportEntry{
+			{User: "analyst", Database: "shop", ObjectType: ObjectTypeTable, Schema: "public", Name: "orders", Privilege: PrivilegeSelect, Via: "readers"},
+			{User: "analyst", Database: "shop", ObjectType: ObjectTypeFunction, Schema: "public", Name: "total(integer, integer)", Privilege: PrivilegeExecute, Via: "PUBLIC"},
+			{User: "app", Database: "shop", ObjectType: ObjectTypeTable, Schema: "public", Name: "a|b", Column: "id", Privilege: PrivilegeUpdate, Grantable: true, Via: "app"},
+		},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, report.WriteCSV(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "user,database,object_type,schema,name,column,privilege,grantable,via", lines[0])
+	assert.Equal(t, `analyst,shop,function,public,"total(integer, integer)",,EXECUTE,false,PUBLIC`, lines[2])
+
+	buf.Reset()
+	assert.NoError(t, report.WriteMarkdown(&buf))
+	assert.Contains(t, buf.String(), "Superusers, holding every privilege: admin.")
+	assert.Contains(t, buf.String(), `| app | shop | table | public | a\|b | id | UPDATE | true | app |`)
+
+	buf.Reset()
+	assert.NoError(t, report.WriteJSON(&buf))
+	read, err := ReadPrivilegeReport(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, report, read)
+
+	_, err = ReadPrivilegeReport(strings.NewReader("not json"))
+	assert.Error(t, err)
+}
+
+func TestDiffPrivilegeReports(t *testing.T) {
+	selectOrders := PrivilegeReportEntry{User: "analyst", Database: "shop", ObjectType: ObjectTypeTable, Schema: "public", Name: "orders", Privilege: PrivilegeSelect, Via: "analyst"}
+	deleteOrders := PrivilegeReportEntry{User: "analyst", Database: "shop", ObjectType: ObjectTypeTable, Schema: "public", Name: "orders", Privilege: PrivilegeDelete, Via: "analyst"}
+	connect := PrivilegeReportEntry{User: "analyst", Database: "shop", ObjectType: ObjectTypeDatabase, Privilege: PrivilegeConnect, Via: "PUBLIC"}
+
+	before := &PrivilegeReport{Superusers: []string{"admin"}, Entries: []PrivilegeReportEntry{selectOrders, connect}}
+	after := &PrivilegeReport{Superusers: []string{"admin", "app"}, Entries: []PrivilegeReportEntry{connect, deleteOrders}}
+
+	diff := DiffPrivilegeReports(before, after)
+	assert.False(t, diff.Empty())
+	assert.Equal(t, []PrivilegeReportEntry{deleteOrders}, diff.Added)
+	assert.Equal(t, []PrivilegeReportEntry{selectOrders}, diff.Removed)
+	assert.Equal(t, []string{"app"}, diff.AddedSuperusers)
+	assert.Empty(t, diff.RemovedSuperusers)
+
+	var buf bytes.Buffer
+	assert.NoError(t, diff.WriteMarkdown(&buf))
+	assert.Contains(t, buf.String(), "New superusers: app.")
+	assert.Contains(t, buf.String(), "## Added")
+	assert.Contains(t, buf.String(), "## Removed")
+
+	assert.True(t, DiffPrivilegeReports(after, after).Empty())
+
+	// Users only covered by one of the reports aren't compared
+	limited := &PrivilegeReport{Users: []string{"analyst"}, Entries: []PrivilegeReportEntry{selectOrders, connect}}
+	diff = DiffPrivilegeReports(limited, after)
+	assert.Equal(t, []PrivilegeReportEntry{deleteOrders}, diff.Added)
+	assert.Empty(t, diff.AddedSuperusers)
+	assert.Empty(t, diff.RemovedSuperusers)
+}
+
+func TestPredefinedRolePrivileges(t *testing.T) {
+	orders := Target{Type: ObjectTypeTable, Database: "shop", Schema: "public", Name: "orders"}
+	public := Target{Type: ObjectTypeSchema, Database: "shop", Name: "public"}
+	privileges := []PrivilegeEntry{
+		{Grantee: "app", Privilege: PrivilegeSelect, Target: orders},
+		{Grantee: "app", Privilege: PrivilegeInsert, Target: orders},
+		{Grantee: "app", Privilege: PrivilegeUpdate, Target: orders, Column: "id"},
+		{Grantee: "app", Privilege: PrivilegeCreate, Target: public},
+		{Grantee: "app", Privilege: PrivilegeConnect, Target: Target{Type: ObjectTypeDatabase, Database: "shop"}},
+	}
+
+	entries := predefinedRolePrivileges("pg_read_all_data", privileges, reportedPredefinedRoles["pg_read_all_data"])
+	assert.Equal(t, []PrivilegeEntry{
+		{Grantee: "pg_read_all_data", Privilege: PrivilegeSelect, Target: orders},
+		{Grantee: "pg_read_all_data", Privilege: PrivilegeUsage, Target: public},
+	}, entries)
+}
+
+func TestPostgresController_PrivilegeReport(t *testing.T) {
+	testDB := testDB()
+	group := testUser()
+	testUser := testUser()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateUser(testUser, testPassword())
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	_, err = c.db.Exec(`CREATE ROLE ` + quoteIdent(group) + ` NOLOGIN`)
+	assert.NoError(t, err)
+	defer c.db.Exec(`DROP ROLE ` + quoteIdent(group))
+	_, err = c.db.Exec(`GRANT ` + quoteIdent(group) + ` TO ` + quoteIdent(testUser))
+	assert.NoError(t, err)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	db, err := c.openDB(testDB)
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE orders (id int)`)
+	assert.NoError(t, err)
+
+	err = c.GrantPrivileges(PrivilegeGrant{
+		Grantee:    group,
+		Privileges: []Privilege{PrivilegeSelect},
+		Target:     Target{Type: ObjectTypeTable, Database: testDB, Name: "orders"},
+	})
+	assert.NoError(t, err)
+
+	_, err = c.PrivilegeReport(PrivilegeReportOptions{Databases: []string{testDB}, Users: []string{"no_such_user"}})
+	assert.ErrorIs(t, err, ErrUserDoesNotExist)
+
+	before, err := c.PrivilegeReport(PrivilegeReportOptions{Databases: []string{testDB}, Users: []string{testUser, pc.Username}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{testUser, pc.Username}, before.Users)
+	assert.Equal(t, []string{pc.Username}, before.Superusers)
+	assert.Contains(t, before.Entries, PrivilegeReportEntry{User: testUser, Database: testDB, ObjectType: ObjectTypeTable, Schema: "public", Name: "orders", Privilege: PrivilegeSelect, Via: group})
+	assert.Contains(t, before.Entries, PrivilegeReportEntry{User: testUser, Database: testDB, ObjectType: ObjectTypeDatabase, Privilege: PrivilegeConnect, Via: "PUBLIC"})
+
+	err = c.GrantPrivileges(PrivilegeGrant{
+		Grantee:    testUser,
+		Privileges: []Privilege{PrivilegeInsert},
+		Target:     Target{Type: ObjectTypeTable, Database: testDB, Name: "orders"},
+	})
+	assert.NoError(t, err)
+
+	after, err := c.PrivilegeReport(PrivilegeReportOptions{Databases: []string{testDB}, Users: []string{testUser}})
+	assert.NoError(t, err)
+	diff := DiffPrivilegeReports(before, after)
+	assert.Equal(t, []PrivilegeReportEntry{{User: testUser, Database: testDB, ObjectType: ObjectTypeTable, Schema: "public", Name: "orders", Privilege: PrivilegeInsert, Via: testUser}}, diff.Added)
+	assert.Empty(t, diff.Removed)
+	assert.Empty(t, diff.RemovedSuperusers)
+}
+
+func TestPostgresController_PrivilegeReportPredefinedRoles(t *testing.T) {
+	testDB := testDB()
+	testUser := testUser()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateUser(testUser, testPassword())
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	err = c.GrantPredefinedRole(testUser, "pg_read_all_data")
+	assert.NoError(t, err)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	db, err := c.openDB(testDB)
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE orders (id int)`)
+	assert.NoError(t, err)
+
+	report, err := c.PrivilegeReport(PrivilegeReportOptions{Databases: []string{testDB}, Users: []string{testUser}})
+	assert.NoError(t, err)
+	assert.Contains(t, report.Entries, PrivilegeReportEntry{User: testUser, Database: testDB, ObjectType: ObjectTypeTable, Schema: "public", Name: "orders", Privilege: PrivilegeSelect, Via: "pg_read_all_data"})
+	assert.NotContains(t, report.Entries, PrivilegeReportEntry{User: testUser, Database: testDB, ObjectType: ObjectTypeTable, Schema: "public", Name: "orders", Privilege: PrivilegeInsert, Via: "pg_read_all_data"})
+}
+
+func TestPostgresController_PrivilegeReportSkipsClosedDatabases(t *testing.T) {
+	testDB := testDB()
+	closedDB := testDB + "_closed"
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	err = c.CreateDatabase(closedDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(closedDB)
+	err = c.setAllowConnections(closedDB, false)
+	assert.NoError(t, err)
+
+	report, err := c.PrivilegeReport(PrivilegeReportOptions{Databases: []string{testDB, closedDB}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{testDB}, report.Databases)
+	assert.Equal(t, []string{closedDB}, report.SkippedDatabases)
+}
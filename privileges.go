@@ -0,0 +1,690 @@
+// postgresctl/privileges.go
+package postgresctl
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PrivilegeController grants privileges on exactly the objects a Target
+// names, unlike Grant which picks the objects from the privilege.
+type PrivilegeController interface {
+	GrantPrivileges(grant PrivilegeGrant) error
+	RevokePrivileges(grant PrivilegeGrant) error
+	ListPrivileges(dbName string) ([]PrivilegeEntry, error)
+	GrantColumns(dbName, schema, table string, columns []string, privileges []Privilege, username string, opts GrantOptions) error
+	RevokeColumns(dbName, schema, table string, columns []string, privileges []Privilege, username string, opts GrantOptions) error
+}
+
+var _ PrivilegeController = &PostgresController{}
+
+type Privilege string
+
+const (
+	PrivilegeSelect     Privilege = "SELECT"
+	PrivilegeInsert     Privilege = "INSERT"
+	PrivilegeUpdate     Privilege = "UPDATE"
+	PrivilegeDelete     Privilege = "DELETE"
+	PrivilegeTruncate   Privilege = "TRUNCATE"
+	PrivilegeReferences Privilege = "REFERENCES"
+	PrivilegeTrigger    Privilege = "TRIGGER"
+	PrivilegeCreate     Privilege = "CREATE"
+	PrivilegeConnect    Privilege = "CONNECT"
+	PrivilegeTemporary  Privilege = "TEMPORARY"
+	PrivilegeExecute    Privilege = "EXECUTE"
+	PrivilegeUsage      Privilege = "USAGE"
+	// PostgreSQL 17+
+	PrivilegeMaintain Privilege = "MAINTAIN"
+	// PrivilegeAll is every privilege the object type has
+	PrivilegeAll Privilege = "ALL"
+)
+
+type ObjectType string
+
+const (
+	ObjectTypeDatabase      ObjectType = "database"
+	ObjectTypeSchema        ObjectType = "schema"
+	ObjectTypeTable         ObjectType = "table"
+	ObjectTypeSequence      ObjectType = "sequence"
+	ObjectTypeFunction      ObjectType = "function"
+	ObjectTypeType          ObjectType = "type"
+	ObjectTypeDomain        ObjectType = "domain"
+	ObjectTypeForeignServer ObjectType = "foreign server"
+	ObjectTypeLargeObject   ObjectType = "large object"
+	ObjectTypeTablespace    ObjectType = "tablespace"
+)
+
+var (
+	ErrInvalidPrivilege   = fmt.Errorf("invalid privilege")
+	ErrInvalidTarget      = fmt.Errorf("invalid privilege target")
+	ErrObjectDoesNotExist = fmt.Errorf("no object matches the target")
+	ErrColumnDoesNotExist = fmt.Errorf("column does not exist")
+	// ErrDependentPrivileges is returned when revoking a grant option others
+	// granted privileges through, see PrivilegeGrant.Cascade
+	ErrDependentPrivileges = fmt.Errorf("dependent privileges exist")
+)
+
+// Privileges each object type accepts, as in the GRANT documentation
+var objectPrivileges = map[ObjectType][]Privilege{
+	ObjectTypeDatabase:      {PrivilegeCreate, PrivilegeConnect, PrivilegeTemporary},
+	ObjectTypeSchema:        {PrivilegeCreate, PrivilegeUsage},
+	ObjectTypeTable:         {PrivilegeSelect, PrivilegeInsert, PrivilegeUpdate, PrivilegeDelete, PrivilegeTruncate, PrivilegeReferences, PrivilegeTrigger, PrivilegeMaintain},
+	ObjectTypeSequence:      {PrivilegeUsage, PrivilegeSelect, PrivilegeUpdate},
+	ObjectTypeFunction:      {PrivilegeExecute},
+	ObjectTypeType:          {PrivilegeUsage},
+	ObjectTypeDomain:        {PrivilegeUsage},
+	ObjectTypeForeignServer: {PrivilegeUsage},
+	ObjectTypeLargeObject:   {PrivilegeSelect, PrivilegeUpdate},
+	ObjectTypeTablespace:    {PrivilegeCreate},
+}
+
+// Privileges that can be granted on single columns of a table
+var columnPrivileges = []Privilege{PrivilegeSelect, PrivilegeInsert, PrivilegeUpdate, PrivilegeReferences}
+
+// Keyword used in GRANT ... ON <keyword>. ROUTINE covers functions and
+// procedures alike.
+var objectKeywords = map[ObjectType]string{
+	ObjectTypeDatabase:      "DATABASE",
+	ObjectTypeSchema:        "SCHEMA",
+	ObjectTypeTable:         "TABLE",
+	ObjectTypeSequence:      "SEQUENCE",
+	ObjectTypeFunction:      "ROUTINE",
+	ObjectTypeType:          "TYPE",
+	ObjectTypeDomain:        "DOMAIN",
+	ObjectTypeForeignServer: "FOREIGN SERVER",
+	ObjectTypeLargeObject:   "LARGE OBJECT",
+	ObjectTypeTablespace:    "TABLESPACE",
+}
+
+// Target selects the objects of a grant.
+//
+// Database is the database holding the object, or the object itself for
+// ObjectTypeDatabase. Schema applies to tables, sequences, functions,
+// types and domains and defaults to public. Name is the object's name and
+// may contain * wildcards, e.g. "orders_*" or "*" for every object of the
+// type in the schema. Functions are matched by name, covering all
+// overloads, or by signature as listed by ListPrivileges, e.g.
+// "add(integer, integer)". Large objects are named by their OID and tablespaces don't
+// need a database.
+type Target struct {
+	Type     ObjectType
+	Database string
+	Schema   string
+	Name     string
+}
+
+type PrivilegeGrant struct {
+	// Grantee is a role name or PUBLIC
+	Grantee    string
+	Privileges []Privilege
+	Target     Target
+
+	// WithGrantOption lets the grantee grant the privileges on, not to PUBLIC
+	WithGrantOption bool
+	// GrantedBy records another role as grantor, the controller's user must
+	// be a member of it (PostgreSQL 14+)
+	GrantedBy string
+
+	// Revoke only: Cascade also revokes the privileges others were granted
+	// through this grant, otherwise such dependants make the revoke fail.
+	// GrantOptionOnly revokes the grant option and keeps the privileges.
+	Cascade         bool
+	GrantOptionOnly bool
+}
+
+// GrantOptions are the delegation fields of PrivilegeGrant for GrantColumns,
+// RevokeColumns, GrantWithOptions and RevokeWithOptions
+type GrantOptions struct {
+	WithGrantOption bool
+	GrantedBy       string
+	Cascade         bool
+	GrantOptionOnly bool
+}
+
+// PrivilegeEntry is one privilege held on one object. Objects that were
+// never granted on are listed with their default privileges.
+type PrivilegeEntry struct {
+	// Grantee is a role name or PUBLIC
+	Grantee   string
+	Grantor   string
+	Privilege Privilege
+	// Grantable is set when the grantee may grant the privilege on
+	Grantable bool
+	// Target names a single object, Name is empty for databases
+	Target Target
+	// Column is set for column privileges, Target is then the table
+	Column string
+}
+
+func (c *PostgresController) GrantPrivileges(grant PrivilegeGrant) error {
+	stmts, err := c.privilegeStatements("GRANT", grant)
+	if err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+	return c.execPrivilegeStatements(grant.Target, stmts)
+}
+
+func (c *PostgresController) RevokePrivileges(grant PrivilegeGrant) error {
+	stmts, err := c.privilegeStatements("REVOKE", grant)
+	if err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+	return c.execPrivilegeStatements(grant.Target, stmts)
+}
+
+// privilegeStatements validates grant, resolves its target and returns the
+// GRANT or REVOKE statement to run.
+func (c *PostgresController) privilegeStatements(action string, grant PrivilegeGrant) ([]string, error) {
+	grantee, err := quoteGrantee(grant.Grantee)
+	if err != nil {
+		return nil, err
+	}
+	privileges, err := c.validatePrivileges(grant.Target.Type, grant.Privileges)
+	if err != nil {
+		return nil, err
+	}
+	prefix, options, err := c.grantOptions(action, grant.Grantee, GrantOptions{
+		WithGrantOption: grant.WithGrantOption,
+		GrantedBy:       grant.GrantedBy,
+		Cascade:         grant.Cascade,
+		GrantOptionOnly: grant.GrantOptionOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+	privileges = prefix + privileges
+
+	objects, err := c.resolveTarget(grant.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	on := objectKeywords[grant.Target.Type] + " " + strings.Join(objects, ", ")
+	if action == "GRANT" {
+		return []string{"GRANT " + privileges + " ON " + on + " TO " + grantee + options}, nil
+	}
+	return []string{"REVOKE " + privileges + " ON " + on + " FROM " + grantee + options}, nil
+}
+
+// grantOptions validates the delegation fields of grant and returns the
+// clauses following the grantee.
+func (c *PostgresController) grantOptions(action, grantee string, grant GrantOptions) (string, string, error) {
+	var prefix, suffix string
+	if action == "GRANT" {
+		if grant.Cascade || grant.GrantOptionOnly {
+			return "", "", fmt.Errorf("%w: Cascade and GrantOptionOnly only apply to revokes", ErrInvalidPrivilege)
+		}
+		if grant.WithGrantOption {
+			if strings.EqualFold(grantee, "PUBLIC") {
+				return "", "", fmt.Errorf("%w: grant options can't be granted to PUBLIC", ErrInvalidPrivilege)
+			}
+			suffix += " WITH GRANT OPTION"
+		}
+	} else {
+		if grant.WithGrantOption {
+			return "", "", fmt.Errorf("%w: WithGrantOption only applies to grants, see GrantOptionOnly", ErrInvalidPrivilege)
+		}
+		if grant.GrantOptionOnly {
+			prefix = "GRANT OPTION FOR "
+		}
+	}
+
+	if grant.GrantedBy != "" {
+		if err := c.requireVersion("GRANTED BY", postgres14); err != nil {
+			return "", "", err
+		}
+		// The grantor may well be a reserved user such as postgres
+		if exists, err := c.roleExists(grant.GrantedBy); err != nil {
+			return "", "", err
+		} else if !exists {
+			return "", "", fmt.Errorf("%w: %s", ErrUserDoesNotExist, grant.GrantedBy)
+		}
+		suffix += " GRANTED BY " + quoteIdent(grant.GrantedBy)
+	}
+
+	if action == "REVOKE" {
+		if grant.Cascade {
+			suffix += " CASCADE"
+		} else {
+			suffix += " RESTRICT"
+		}
+	}
+	return prefix, suffix, nil
+}
+
+func (c *PostgresController) execPrivilegeStatements(target Target, stmts []string) error {
+	db := c.db
+	if targetInDatabase(target.Type) {
+		var err error
+		db, err = c.openDB(target.Database)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+	}
+
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			if strings.Contains(err.Error(), "dependent privileges exist") {
+				return fmt.Errorf("%w: %w", ErrDependentPrivileges, err)
+			}
+			if strings.Contains(err.Error(), "does not exist") {
+				// e.g. role "x" does not exist, relation "y" does not exist
+				if strings.HasPrefix(strings.TrimPrefix(err.Error(), "pq: "), "role ") {
+					return fmt.Errorf("%w: %w", ErrUserDoesNotExist, err)
+				}
+				return fmt.Errorf("%w: %w", ErrObjectDoesNotExist, err)
+			}
+			return fmt.Errorf("error changing privileges: %w", err)
+		}
+	}
+	return nil
+}
+
+// GrantColumns grants privileges on some columns of a table only, e.g.
+// SELECT on everything in customers except email. schema defaults to public.
+func (c *PostgresController) GrantColumns(dbName, schema, table string, columns []string, privileges []Privilege, username string, opts GrantOptions) error {
+	stmt, err := c.columnPrivilegeStatement("GRANT", dbName, schema, table, columns, privileges, username, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+	return c.execPrivilegeStatements(Target{Type: ObjectTypeTable, Database: dbName}, []string{stmt})
+}
+
+// RevokeColumns revokes column privileges granted by GrantColumns. It
+// doesn't touch privileges on the whole table, which still cover every
+// column.
+func (c *PostgresController) RevokeColumns(dbName, schema, table string, columns []string, privileges []Privilege, username string, opts GrantOptions) error {
+	stmt, err := c.columnPrivilegeStatement("REVOKE", dbName, schema, table, columns, privileges, username, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+	return c.execPrivilegeStatements(Target{Type: ObjectTypeTable, Database: dbName}, []string{stmt})
+}
+
+func (c *PostgresController) columnPrivilegeStatement(action, dbName, schema, table string, columns []string, privileges []Privilege, username string, opts GrantOptions) (string, error) {
+	grantee, err := quoteGrantee(username)
+	if err != nil {
+		return "", err
+	}
+	prefix, options, err := c.grantOptions(action, username, opts)
+	if err != nil {
+		return "", err
+	}
+	if len(columns) == 0 {
+		return "", fmt.Errorf("%w: no columns given", ErrInvalidTarget)
+	}
+	if len(privileges) == 0 {
+		return "", fmt.Errorf("%w: no privileges given", ErrInvalidPrivilege)
+	}
+	for _, p := range privileges {
+		if !containsPrivilege(columnPrivileges, Privilege(strings.ToUpper(string(p)))) {
+			return "", fmt.Errorf("%w: %s can't be granted on columns", ErrInvalidPrivilege, p)
+		}
+	}
+
+	if schema == "" {
+		schema = "public"
+	}
+	if strings.Contains(table, "*") {
+		return "", fmt.Errorf("%w: column privileges need a single table", ErrInvalidTarget)
+	}
+	tables, err := c.resolveTarget(Target{Type: ObjectTypeTable, Database: dbName, Schema: schema, Name: table})
+	if err != nil {
+		return "", err
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	existing, err := queryStrings(db, `
+		SELECT a.attname FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2
+		AND a.attnum > 0 AND NOT a.attisdropped
+	`, schema, table)
+	if err != nil {
+		return "", fmt.Errorf("error listing columns: %w", err)
+	}
+
+	var quoted []string
+	for _, column := range columns {
+		if !contains(existing, column) {
+			return "", fmt.Errorf("%w: %s.%s.%s", ErrColumnDoesNotExist, schema, table, column)
+		}
+		quoted = append(quoted, quoteIdent(column))
+	}
+	columnList := " (" + strings.Join(quoted, ", ") + ")"
+
+	var list []string
+	for _, p := range privileges {
+		list = append(list, strings.ToUpper(string(p))+columnList)
+	}
+
+	on := " ON TABLE " + tables[0]
+	if action == "GRANT" {
+		return "GRANT " + strings.Join(list, ", ") + on + " TO " + grantee + options, nil
+	}
+	return "REVOKE " + prefix + strings.Join(list, ", ") + on + " FROM " + grantee + options, nil
+}
+
+// validatePrivileges checks privileges against the object type and returns
+// them as a GRANT privilege list.
+func (c *PostgresController) validatePrivileges(objectType ObjectType, privileges []Privilege) (string, error) {
+	allowed, ok := objectPrivileges[objectType]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown object type %q", ErrInvalidTarget, objectType)
+	}
+	if len(privileges) == 0 {
+		return "", fmt.Errorf("%w: no privileges given", ErrInvalidPrivilege)
+	}
+
+	var names []string
+	for _, p := range privileges {
+		p = Privilege(strings.ToUpper(string(p)))
+		if p == PrivilegeAll {
+			if len(privileges) > 1 {
+				return "", fmt.Errorf("%w: ALL can't be combined with other privileges", ErrInvalidPrivilege)
+			}
+			return "ALL PRIVILEGES", nil
+		}
+		if !containsPrivilege(allowed, p) {
+			return "", fmt.Errorf("%w: %s is not a privilege of a %s", ErrInvalidPrivilege, p, objectType)
+		}
+		if p == PrivilegeMaintain {
+			if err := c.requireVersion("the MAINTAIN privilege", postgres17); err != nil {
+				return "", err
+			}
+		}
+		names = append(names, string(p))
+	}
+
+	return strings.Join(names, ", "), nil
+}
+
+// resolveTarget returns the quoted names of the objects target matches
+func (c *PostgresController) resolveTarget(target Target) ([]string, error) {
+	if target.Type == ObjectTypeTablespace {
+		if target.Name == "" {
+			return nil, fmt.Errorf("%w: tablespace name is empty", ErrInvalidTarget)
+		}
+		return queryTargetNames(c.db, `
+			SELECT format('%I', spcname) FROM pg_tablespace
+			WHERE spcname LIKE $1 ORDER BY 1
+		`, targetPattern(target.Name))
+	}
+
+	if err := validateDBName(target.Database); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTarget, err)
+	}
+	if exists, err := c.DatabaseExists(target.Database); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, ErrDBDoesNotExist
+	}
+
+	if target.Type == ObjectTypeDatabase {
+		return []string{`"` + target.Database + `"`}, nil
+	}
+	if target.Name == "" {
+		return nil, fmt.Errorf("%w: %s name is empty", ErrInvalidTarget, target.Type)
+	}
+
+	db, err := c.openDB(target.Database)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	schema := target.Schema
+	if schema == "" {
+		schema = "public"
+	}
+	pattern := targetPattern(target.Name)
+
+	switch target.Type {
+	case ObjectTypeSchema:
+		return queryTargetNames(db, `
+			SELECT format('%I', nspname) FROM pg_namespace
+			WHERE nspname LIKE $1
+			AND nspname NOT LIKE 'pg\_%' AND nspname <> 'information_schema'
+			ORDER BY 1
+		`, pattern)
+	case ObjectTypeTable, ObjectTypeSequence:
+		relkinds := "'r', 'p', 'v', 'm', 'f'"
+		if target.Type == ObjectTypeSequence {
+			relkinds = "'S'"
+		}
+		return queryTargetNames(db, `
+			SELECT format('%I.%I', n.nspname, c.relname)
+			FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = $1 AND c.relname LIKE $2
+			AND c.relkind IN (`+relkinds+`)
+			ORDER BY 1
+		`, schema, pattern)
+	case ObjectTypeFunction:
+		return queryTargetNames(db, `
+			SELECT format('%I.%I(%s)', n.nspname, p.proname, pg_catalog.pg_get_function_identity_arguments(p.oid))
+			FROM pg_proc p
+			JOIN pg_namespace n ON n.oid = p.pronamespace
+			WHERE n.nspname = $1 AND p.prokind IN ('f', 'p')
+			AND (p.proname LIKE $2 OR format('%s(%s)', p.proname, pg_catalog.oidvectortypes(p.proargtypes)) = $3)
+			ORDER BY 1
+		`, schema, pattern, target.Name)
+	case ObjectTypeType, ObjectTypeDomain:
+		typtypes := "'b', 'e', 'r', 'm'"
+		if target.Type == ObjectTypeDomain {
+			typtypes = "'d'"
+		}
+		return queryTargetNames(db, `
+			SELECT format('%I.%I', n.nspname, t.typname)
+			FROM pg_type t
+			JOIN pg_namespace n ON n.oid = t.typnamespace
+			LEFT JOIN pg_class c ON c.oid = t.typrelid
+			WHERE n.nspname = $1 AND t.typname LIKE $2
+			AND (t.typtype IN (`+typtypes+`) OR (t.typtype = 'c' AND c.relkind = 'c' AND $3))
+			AND t.typelem = 0
+			ORDER BY 1
+		`, schema, pattern, target.Type == ObjectTypeType)
+	case ObjectTypeForeignServer:
+		return queryTargetNames(db, `
+			SELECT format('%I', srvname) FROM pg_foreign_server
+			WHERE srvname LIKE $1 ORDER BY 1
+		`, pattern)
+	case ObjectTypeLargeObject:
+		oid, err := strconv.ParseUint(target.Name, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: large objects are named by their OID, got %q", ErrInvalidTarget, target.Name)
+		}
+		return queryTargetNames(db, `
+			SELECT oid::text FROM pg_largeobject_metadata WHERE oid = $1
+		`, oid)
+	}
+
+	return nil, fmt.Errorf("%w: unknown object type %q", ErrInvalidTarget, target.Type)
+}
+
+func queryTargetNames(db *sql.DB, query string, args ...any) ([]string, error) {
+	names, err := queryStrings(db, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving privilege target: %w", err)
+	}
+	if len(names) == 0 {
+		return nil, ErrObjectDoesNotExist
+	}
+	return names, nil
+}
+
+// Objects with an aclitem[], their default ACL kind and owner. Columns
+// are only listed when they carry privileges of their own.
+const privilegeObjectsQuery = `
+	SELECT 'database', current_database(), '', '', '', d.datacl, 'd', d.datdba
+	FROM pg_database d
+	WHERE d.datname = current_database()
+	UNION ALL
+	SELECT 'schema', current_database(), '', n.nspname, '', n.nspacl, 'n', n.nspowner
+	FROM pg_namespace n
+	WHERE n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+	UNION ALL
+	SELECT CASE c.relkind WHEN 'S' THEN 'sequence' ELSE 'table' END, current_database(), n.nspname, c.relname,
+		'', c.relacl, CASE c.relkind WHEN 'S' THEN 's' ELSE 'r' END, c.relowner
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f', 'S')
+	AND n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+	UNION ALL
+	SELECT 'function', current_database(), n.nspname,
+		format('%s(%s)', p.proname, pg_catalog.oidvectortypes(p.proargtypes)), '', p.proacl, 'f', p.proowner
+	FROM pg_proc p
+	JOIN pg_namespace n ON n.oid = p.pronamespace
+	WHERE p.prokind IN ('f', 'p')
+	AND n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+	UNION ALL
+	SELECT CASE t.typtype WHEN 'd' THEN 'domain' ELSE 'type' END, current_database(), n.nspname, t.typname,
+		'', t.typacl, 'T', t.typowner
+	FROM pg_type t
+	JOIN pg_namespace n ON n.oid = t.typnamespace
+	LEFT JOIN pg_class c ON c.oid = t.typrelid
+	WHERE (t.typtype IN ('b', 'd', 'e', 'r', 'm') OR (t.typtype = 'c' AND c.relkind = 'c'))
+	AND t.typelem = 0
+	AND n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+	UNION ALL
+	SELECT 'foreign server', current_database(), '', s.srvname, '', s.srvacl, 'S', s.srvowner
+	FROM pg_foreign_server s
+	UNION ALL
+	SELECT 'large object', current_database(), '', l.oid::text, '', l.lomacl, 'L', l.lomowner
+	FROM pg_largeobject_metadata l
+	UNION ALL
+	SELECT 'table', current_database(), n.nspname, c.relname, a.attname, a.attacl, 'c', c.relowner
+	FROM pg_attribute a
+	JOIN pg_class c ON c.oid = a.attrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE a.attacl IS NOT NULL AND a.attnum > 0 AND NOT a.attisdropped
+	AND n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+`
+
+// ListPrivileges lists the privileges on dbName and every object inside it.
+// System schemas are skipped.
+func (c *PostgresController) ListPrivileges(dbName string) ([]PrivilegeEntry, error) {
+	if err := validateDBName(dbName); err != nil {
+		return nil, err
+	}
+	if exists, err := c.DatabaseExists(dbName); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, ErrDBDoesNotExist
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		WITH objects(type, database, schema, name, colname, acl, kind, owner) AS (` + privilegeObjectsQuery + `)
+		SELECT o.type, o.database, o.schema, o.name, o.colname,
+			CASE a.grantee WHEN 0 THEN 'PUBLIC' ELSE pg_catalog.pg_get_userbyid(a.grantee) END,
+			pg_catalog.pg_get_userbyid(a.grantor),
+			a.privilege_type, a.is_grantable
+		FROM objects o, aclexplode(COALESCE(o.acl, acldefault(o.kind::"char", o.owner))) a
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing privileges: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []PrivilegeEntry
+	for rows.Next() {
+		var e PrivilegeEntry
+		var objectType, privilege string
+		err := rows.Scan(&objectType, &e.Target.Database, &e.Target.Schema, &e.Target.Name, &e.Column, &e.Grantee, &e.Grantor, &privilege, &e.Grantable)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning privilege: %w", err)
+		}
+		e.Target.Type = ObjectType(objectType)
+		e.Privilege = Privilege(privilege)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sortPrivilegeEntries(entries)
+	return entries, nil
+}
+
+func sortPrivilegeEntries(entries []PrivilegeEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Target.Type != b.Target.Type {
+			return a.Target.Type < b.Target.Type
+		}
+		if a.Target.Schema != b.Target.Schema {
+			return a.Target.Schema < b.Target.Schema
+		}
+		if a.Target.Name != b.Target.Name {
+			return a.Target.Name < b.Target.Name
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		if a.Grantee != b.Grantee {
+			return a.Grantee < b.Grantee
+		}
+		return a.Privilege < b.Privilege
+	})
+}
+
+func targetInDatabase(objectType ObjectType) bool {
+	return objectType != ObjectTypeDatabase && objectType != ObjectTypeTablespace
+}
+
+// targetPattern turns a name with * wildcards into a LIKE pattern
+func targetPattern(name string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(name)
+	return strings.ReplaceAll(escaped, "*", "%")
+}
+
+func quoteGrantee(grantee string) (string, error) {
+	if strings.EqualFold(grantee, "PUBLIC") {
+		return "PUBLIC", nil
+	}
+	if err := validateUsername(grantee); err != nil {
+		return "", err
+	}
+	return quoteIdent(grantee), nil
+}
+
+func containsPrivilege(privileges []Privilege, p Privilege) bool {
+	for _, privilege := range privileges {
+		if privilege == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,312 @@
+// postgresctl/privileges_test.go
+package postgresctl
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTargetPattern(t *testing.T) {
+	assert.Equal(t, "orders", targetPattern("orders"))
+	assert.Equal(t, "orders\\_%", targetPattern("orders_*"))
+	assert.Equal(t, "%", targetPattern("*"))
+	assert.Equal(t, "50\\%\\\\off", targetPattern("50%\\off"))
+}
+
+func TestPostgresController_GrantPrivileges(t *testing.T) {
+	testDB := testDB()
+	testUser := testUser()
+	testPassword := testPassword()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateUser(testUser, testPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	db, err := c.openDB(testDB)
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`
+		CREATE TABLE orders_2024 (id int);
+		CREATE TABLE orders_2025 (id int);
+		CREATE TABLE customers (id serial);
+		CREATE FUNCTION add(a int, b int) RETURNS int LANGUAGE sql AS 'SELECT a + b';
+	`)
+	assert.NoError(t, err)
+
+	tables := Target{Type: ObjectTypeTable, Database: testDB, Name: "orders_*"}
+
+	// Incompatible privileges
+	err = c.GrantPrivileges(PrivilegeGrant{Grantee: testUser, Privileges: []Privilege{PrivilegeExecute}, Target: tables})
+	assert.ErrorIs(t, err, ErrInvalidPrivilege)
+	err = c.GrantPrivileges(PrivilegeGrant{Grantee: testUser, Privileges: []Privilege{PrivilegeAll, PrivilegeSelect}, Target: tables})
+	assert.ErrorIs(t, err, ErrInvalidPrivilege)
+	err = c.GrantPrivileges(PrivilegeGrant{Grantee: testUser, Privileges: []Privilege{PrivilegeUsage}, Target: Target{Type: "view", Database: testDB, Name: "x"}})
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+
+	// Nothing matches
+	err = c.GrantPrivileges(PrivilegeGrant{Grantee: testUser, Privileges: []Privilege{PrivilegeSelect}, Target: Target{Type: ObjectTypeTable, Database: testDB, Name: "invoices"}})
+	assert.ErrorIs(t, err, ErrObjectDoesNotExist)
+
+	err = c.GrantPrivileges(PrivilegeGrant{Grantee: testUser, Privileges: []Privilege{PrivilegeSelect}, Target: tables})
+	assert.NoError(t, err)
+	err = c.GrantPrivileges(PrivilegeGrant{Grantee: testUser, Privileges: []Privilege{"usage"}, Target: Target{Type: ObjectTypeSequence, Database: testDB, Name: "*"}})
+	assert.NoError(t, err)
+	err = c.GrantPrivileges(PrivilegeGrant{Grantee: "public", Privileges: []Privilege{PrivilegeExecute}, Target: Target{Type: ObjectTypeFunction, Database: testDB, Name: "add"}})
+	assert.NoError(t, err)
+
+	entries, err := c.ListPrivileges(testDB)
+	assert.NoError(t, err)
+	assert.Contains(t, entries, PrivilegeEntry{
+		Grantee:   testUser,
+		Grantor:   pc.Username,
+		Privilege: PrivilegeSelect,
+		Target:    Target{Type: ObjectTypeTable, Database: testDB, Schema: "public", Name: "orders_2025"},
+	})
+	assert.Contains(t, entries, PrivilegeEntry{
+		Grantee:   testUser,
+		Grantor:   pc.Username,
+		Privilege: PrivilegeUsage,
+		Target:    Target{Type: ObjectTypeSequence, Database: testDB, Schema: "public", Name: "customers_id_seq"},
+	})
+	assert.Contains(t, entries, PrivilegeEntry{
+		Grantee:   "PUBLIC",
+		Grantor:   pc.Username,
+		Privilege: PrivilegeExecute,
+		Target:    Target{Type: ObjectTypeFunction, Database: testDB, Schema: "public", Name: "add(integer, integer)"},
+	})
+	for _, e := range entries {
+		if e.Grantee == testUser && e.Target.Name == "customers" {
+			t.Errorf("unexpected privilege on customers: %+v", e)
+		}
+	}
+
+	// Listed names can be passed back
+	err = c.RevokePrivileges(PrivilegeGrant{Grantee: "PUBLIC", Privileges: []Privilege{PrivilegeExecute}, Target: Target{Type: ObjectTypeFunction, Database: testDB, Name: "add(integer, integer)"}})
+	assert.NoError(t, err)
+
+	err = c.GrantPrivileges(PrivilegeGrant{Grantee: "no_such_user", Privileges: []Privilege{PrivilegeSelect}, Target: tables})
+	assert.ErrorIs(t, err, ErrUserDoesNotExist)
+
+	err = c.RevokePrivileges(PrivilegeGrant{Grantee: testUser, Privileges: []Privilege{PrivilegeSelect}, Target: tables})
+	assert.NoError(t, err)
+
+	entries, err = c.ListPrivileges(testDB)
+	assert.NoError(t, err)
+	for _, e := range entries {
+		if e.Grantee == "PUBLIC" && e.Target.Type == ObjectTypeFunction {
+			t.Errorf("privilege not revoked: %+v", e)
+		}
+		if e.Grantee == testUser && e.Target.Type == ObjectTypeTable {
+			t.Errorf("privilege not revoked: %+v", e)
+		}
+	}
+}
+
+func TestPostgresController_GrantColumns(t *testing.T) {
+	testDB := testDB()
+	testUser := testUser()
+	testPassword := testPassword()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateUser(testUser, testPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	db, err := c.openDB(testDB)
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE customers (id int, name text, email text, ssn text)`)
+	assert.NoError(t, err)
+
+	err = c.GrantColumns(testDB, "", "customers", []string{"id", "phone"}, []Privilege{PrivilegeSelect}, testUser, GrantOptions{})
+	assert.ErrorIs(t, err, ErrColumnDoesNotExist)
+	err = c.GrantColumns(testDB, "", "customers", []string{"id"}, []Privilege{PrivilegeDelete}, testUser, GrantOptions{})
+	assert.ErrorIs(t, err, ErrInvalidPrivilege)
+	err = c.GrantColumns(testDB, "", "invoices", []string{"id"}, []Privilege{PrivilegeSelect}, testUser, GrantOptions{})
+	assert.ErrorIs(t, err, ErrObjectDoesNotExist)
+
+	err = c.GrantColumns(testDB, "public", "customers", []string{"id", "name"}, []Privilege{PrivilegeSelect, PrivilegeUpdate}, testUser, GrantOptions{})
+	assert.NoError(t, err)
+
+	userDB, err := sql.Open("postgres", fmt.Sprintf("postgres://%s:%s@localhost:55432/%s?sslmode=disable", testUser, testPassword, testDB))
+	assert.NoError(t, err)
+	defer userDB.Close()
+	_, err = userDB.Exec(`SELECT id, name FROM customers`)
+	assert.NoError(t, err)
+	_, err = userDB.Exec(`SELECT email FROM customers`)
+	assert.Error(t, err)
+
+	entries, err := c.ListPrivileges(testDB)
+	assert.NoError(t, err)
+	var columns []string
+	for _, e := range entries {
+		if e.Grantee == testUser {
+			assert.Equal(t, "customers", e.Target.Name)
+			columns = append(columns, e.Column+" "+string(e.Privilege))
+		}
+	}
+	assert.ElementsMatch(t, []string{"id SELECT", "id UPDATE", "name SELECT", "name UPDATE"}, columns)
+
+	err = c.RevokeColumns(testDB, "", "customers", []string{"name"}, []Privilege{PrivilegeUpdate}, testUser, GrantOptions{})
+	assert.NoError(t, err)
+
+	entries, err = c.ListPrivileges(testDB)
+	assert.NoError(t, err)
+	for _, e := range entries {
+		if e.Grantee == testUser && e.Column == "name" {
+			assert.Equal(t, PrivilegeSelect, e.Privilege)
+		}
+	}
+}
+
+func TestPostgresController_GrantPrivileges_GrantOption(t *testing.T) {
+	testDB := testDB()
+	admin := testUser()
+	analyst := testUser()
+	testPassword := testPassword()
+
+	c := createTestController()
+	defer c.Close()
+
+	for _, user := range []string{admin, analyst} {
+		err := c.CreateUser(user, testPassword)
+		assert.NoError(t, err)
+		defer c.DeleteUser(user)
+	}
+
+	err := c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	db, err := c.openDB(testDB)
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE reports (id int)`)
+	assert.NoError(t, err)
+
+	reports := Target{Type: ObjectTypeTable, Database: testDB, Name: "reports"}
+
+	err = c.GrantPrivileges(PrivilegeGrant{Grantee: "PUBLIC", Privileges: []Privilege{PrivilegeSelect}, Target: reports, WithGrantOption: true})
+	assert.ErrorIs(t, err, ErrInvalidPrivilege)
+	err = c.GrantPrivileges(PrivilegeGrant{Grantee: admin, Privileges: []Privilege{PrivilegeSelect}, Target: reports, Cascade: true})
+	assert.ErrorIs(t, err, ErrInvalidPrivilege)
+
+	err = c.GrantPrivileges(PrivilegeGrant{Grantee: admin, Privileges: []Privilege{PrivilegeSelect}, Target: reports, WithGrantOption: true})
+	assert.NoError(t, err)
+
+	// The admin delegates on their own
+	adminDB, err := sql.Open("postgres", fmt.Sprintf("postgres://%s:%s@localhost:55432/%s?sslmode=disable", admin, testPassword, testDB))
+	assert.NoError(t, err)
+	defer adminDB.Close()
+	_, err = adminDB.Exec(`GRANT SELECT ON reports TO ` + quoteIdent(analyst))
+	assert.NoError(t, err)
+
+	entries, err := c.ListPrivileges(testDB)
+	assert.NoError(t, err)
+	assert.Contains(t, entries, PrivilegeEntry{Grantee: admin, Grantor: pc.Username, Privilege: PrivilegeSelect, Grantable: true, Target: Target{Type: ObjectTypeTable, Database: testDB, Schema: "public", Name: "reports"}})
+	assert.Contains(t, entries, PrivilegeEntry{Grantee: analyst, Grantor: admin, Privilege: PrivilegeSelect, Target: Target{Type: ObjectTypeTable, Database: testDB, Schema: "public", Name: "reports"}})
+
+	revoke := PrivilegeGrant{Grantee: admin, Privileges: []Privilege{PrivilegeSelect}, Target: reports, GrantOptionOnly: true}
+	err = c.RevokePrivileges(revoke)
+	assert.ErrorIs(t, err, ErrDependentPrivileges)
+
+	revoke.Cascade = true
+	err = c.RevokePrivileges(revoke)
+	assert.NoError(t, err)
+
+	entries, err = c.ListPrivileges(testDB)
+	assert.NoError(t, err)
+	assert.Contains(t, entries, PrivilegeEntry{Grantee: admin, Grantor: pc.Username, Privilege: PrivilegeSelect, Target: Target{Type: ObjectTypeTable, Database: testDB, Schema: "public", Name: "reports"}})
+	for _, e := range entries {
+		assert.NotEqual(t, analyst, e.Grantee)
+	}
+
+	err = c.GrantPrivileges(PrivilegeGrant{Grantee: admin, Privileges: []Privilege{PrivilegeSelect}, Target: reports, WithGrantOption: true})
+	assert.NoError(t, err)
+
+	caps, err := c.Capabilities()
+	assert.NoError(t, err)
+	err = c.GrantPrivileges(PrivilegeGrant{Grantee: analyst, Privileges: []Privilege{PrivilegeSelect}, Target: reports, GrantedBy: admin})
+	if caps.VersionNum >= postgres14 {
+		assert.NoError(t, err)
+		entries, err = c.ListPrivileges(testDB)
+		assert.NoError(t, err)
+		assert.Contains(t, entries, PrivilegeEntry{Grantee: analyst, Grantor: admin, Privilege: PrivilegeSelect, Target: Target{Type: ObjectTypeTable, Database: testDB, Schema: "public", Name: "reports"}})
+
+		// Reserved roles can be grantors, missing ones can't
+		err = c.GrantPrivileges(PrivilegeGrant{Grantee: analyst, Privileges: []Privilege{PrivilegeInsert}, Target: reports, GrantedBy: pc.Username})
+		assert.NoError(t, err)
+		err = c.GrantPrivileges(PrivilegeGrant{Grantee: analyst, Privileges: []Privilege{PrivilegeInsert}, Target: reports, GrantedBy: "no_such_role"})
+		assert.ErrorIs(t, err, ErrUserDoesNotExist)
+	} else {
+		assert.ErrorIs(t, err, ErrUnsupportedByServer)
+	}
+
+	// Column and legacy grants take the same options
+	err = c.GrantColumns(testDB, "", "reports", []string{"id"}, []Privilege{PrivilegeUpdate}, admin, GrantOptions{WithGrantOption: true})
+	assert.NoError(t, err)
+	entries, err = c.ListPrivileges(testDB)
+	assert.NoError(t, err)
+	assert.Contains(t, entries, PrivilegeEntry{Grantee: admin, Grantor: pc.Username, Privilege: PrivilegeUpdate, Grantable: true, Target: Target{Type: ObjectTypeTable, Database: testDB, Schema: "public", Name: "reports"}, Column: "id"})
+
+	err = c.RevokeColumns(testDB, "", "reports", []string{"id"}, []Privilege{PrivilegeUpdate}, admin, GrantOptions{GrantOptionOnly: true})
+	assert.NoError(t, err)
+	entries, err = c.ListPrivileges(testDB)
+	assert.NoError(t, err)
+	assert.Contains(t, entries, PrivilegeEntry{Grantee: admin, Grantor: pc.Username, Privilege: PrivilegeUpdate, Target: Target{Type: ObjectTypeTable, Database: testDB, Schema: "public", Name: "reports"}, Column: "id"})
+
+	err = c.GrantWithOptions("CONNECT", testDB, analyst, GrantOptions{WithGrantOption: true})
+	assert.NoError(t, err)
+	err = c.RevokeWithOptions("CONNECT", testDB, analyst, GrantOptions{Cascade: true})
+	assert.NoError(t, err)
+	err = c.GrantWithOptions("CONNECT", testDB, analyst, GrantOptions{Cascade: true})
+	assert.ErrorIs(t, err, ErrInvalidPrivilege)
+}
+
+func TestPostgresController_ListPrivileges_LargeObject(t *testing.T) {
+	testDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	db, err := c.openDB(testDB)
+	assert.NoError(t, err)
+	defer db.Close()
+	var oid string
+	err = db.QueryRow(`SELECT lo_create(0)::text`).Scan(&oid)
+	assert.NoError(t, err)
+
+	entries, err := c.ListPrivileges(testDB)
+	assert.NoError(t, err)
+	var owner []Privilege
+	for _, e := range entries {
+		if e.Target.Type != ObjectTypeLargeObject || e.Target.Name != oid {
+			continue
+		}
+		assert.NotEqual(t, "PUBLIC", e.Grantee)
+		if e.Grantee == pc.Username {
+			owner = append(owner, e.Privilege)
+		}
+	}
+	assert.ElementsMatch(t, []Privilege{PrivilegeSelect, PrivilegeUpdate}, owner)
+}
@@ -0,0 +1,447 @@
+// postgresctl/quota.go
+package postgresctl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type QuotaAction string
+
+const (
+	// QuotaActionEvent only reports the breach
+	QuotaActionEvent QuotaAction = "event"
+	// QuotaActionReadOnly sets default_transaction_read_only on the database
+	QuotaActionReadOnly QuotaAction = "read_only"
+	// QuotaActionRevokeConnect revokes CONNECT from every non-superuser role
+	QuotaActionRevokeConnect QuotaAction = "revoke_connect"
+)
+
+type QuotaLevel string
+
+const (
+	QuotaLevelSoft QuotaLevel = "soft"
+	QuotaLevelHard QuotaLevel = "hard"
+)
+
+const (
+	defaultQuotaInterval = 5 * time.Minute
+	// quotaStateSetting is a custom database setting holding the actions a
+	// QuotaChecker applied, so a later checker can revert them
+	quotaStateSetting = "pgctl.quota_state"
+)
+
+var (
+	ErrInvalidQuota = fmt.Errorf("invalid quota")
+)
+
+// Quota holds the limits of a database in bytes, zero disables a limit.
+// Levels without actions only emit events.
+type Quota struct {
+	Database    string
+	SoftLimit   int64
+	HardLimit   int64
+	SoftActions []QuotaAction
+	HardActions []QuotaAction
+}
+
+// QuotaEvent describes an action applied on breach, or reverted once the
+// usage dropped below the limit again. A database that could not be checked
+// is reported with only Time, Database and Err set.
+type QuotaEvent struct {
+	Time     time.Time
+	Database string
+	Level    QuotaLevel
+	Size     int64
+	Limit    int64
+	Action   QuotaAction
+	Reverted bool
+	Err      error
+}
+
+type quotaState struct {
+	breached map[QuotaLevel]bool
+	applied  map[QuotaAction]bool
+	// wasReadOnly is set when the database was read-only before
+	// QuotaActionReadOnly was applied, it is left read-only on revert
+	wasReadOnly bool
+	// grantees whose CONNECT was revoked by QuotaActionRevokeConnect
+	revoked []ConnectGrant
+}
+
+// savedQuotaState is the part of quotaState stored in quotaStateSetting.
+// Breaches are not saved, a new checker reports them again.
+type savedQuotaState struct {
+	Applied     []QuotaAction  `json:"applied"`
+	WasReadOnly bool           `json:"was_read_only,omitempty"`
+	Revoked     []ConnectGrant `json:"revoked_connect,omitempty"`
+}
+
+// QuotaChecker periodically compares database sizes against their quotas.
+// Applied actions are recorded in the database's settings, so a checker
+// started after a restart reverts them once the usage drops.
+type QuotaChecker struct {
+	c        *PostgresController
+	interval time.Duration
+	handler  func(QuotaEvent)
+
+	// mu guards quotas and is never held while talking to the server
+	mu     sync.Mutex
+	quotas map[string]Quota
+
+	// enforceMu serializes checks and guards state
+	enforceMu sync.Mutex
+	state     map[string]*quotaState
+}
+
+type QuotaCheckerOption func(*QuotaChecker)
+
+func WithQuotaInterval(interval time.Duration) QuotaCheckerOption {
+	return func(qc *QuotaChecker) {
+		qc.interval = interval
+	}
+}
+
+func WithQuotaHandler(handler func(QuotaEvent)) QuotaCheckerOption {
+	return func(qc *QuotaChecker) {
+		qc.handler = handler
+	}
+}
+
+func NewQuotaChecker(c *PostgresController, quotas []Quota, opts ...QuotaCheckerOption) (*QuotaChecker, error) {
+	qc := &QuotaChecker{
+		c:        c,
+		interval: defaultQuotaInterval,
+		quotas:   map[string]Quota{},
+		state:    map[string]*quotaState{},
+	}
+
+	for _, q := range quotas {
+		if err := qc.SetQuota(q); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, opt := range opts {
+		opt(qc)
+	}
+
+	if qc.interval <= 0 {
+		return nil, fmt.Errorf("quota interval must be positive")
+	}
+
+	return qc, nil
+}
+
+// SetQuota adds or replaces the quota of a database. The new limits are
+// enforced on the next check.
+func (qc *QuotaChecker) SetQuota(q Quota) error {
+	if err := validateQuota(q); err != nil {
+		return err
+	}
+
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+
+	qc.quotas[q.Database] = q
+	return nil
+}
+
+// RemoveQuota stops checking a database. Actions that are still applied
+// are reverted.
+func (qc *QuotaChecker) RemoveQuota(dbName string) []QuotaEvent {
+	qc.mu.Lock()
+	q, ok := qc.quotas[dbName]
+	delete(qc.quotas, dbName)
+	qc.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	qc.enforceMu.Lock()
+	events := qc.enforce(q, 0, map[QuotaLevel]bool{})
+	delete(qc.state, dbName)
+	qc.enforceMu.Unlock()
+
+	qc.notify(events)
+	return events
+}
+
+// Run checks quotas every interval until ctx is done.
+func (qc *QuotaChecker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(qc.interval)
+	defer ticker.Stop()
+
+	for {
+		// Check sends every failed database to the handler as an event,
+		// the joined error it returns holds the same failures
+		qc.Check()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check runs a single pass over all quotas and returns the emitted events.
+// Databases that could not be checked are reported as events with Err set
+// and their errors are returned joined. The handler is called after the
+// pass, so it may change quotas.
+func (qc *QuotaChecker) Check() ([]QuotaEvent, error) {
+	qc.enforceMu.Lock()
+
+	qc.mu.Lock()
+	databases := make([]string, 0, len(qc.quotas))
+	for dbName := range qc.quotas {
+		databases = append(databases, dbName)
+	}
+	qc.mu.Unlock()
+
+	var events []QuotaEvent
+	var errs []error
+	for _, dbName := range databases {
+		size, err := qc.c.Size(dbName)
+		if err != nil {
+			err = fmt.Errorf("error checking quota of %s: %w", dbName, err)
+			events = append(events, QuotaEvent{Time: time.Now(), Database: dbName, Err: err})
+			errs = append(errs, err)
+			continue
+		}
+
+		// The quota may have changed or been removed while sizing
+		qc.mu.Lock()
+		q, ok := qc.quotas[dbName]
+		qc.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		breached := map[QuotaLevel]bool{
+			QuotaLevelSoft: q.SoftLimit > 0 && size >= q.SoftLimit,
+			QuotaLevelHard: q.HardLimit > 0 && size >= q.HardLimit,
+		}
+		events = append(events, qc.enforce(q, size, breached)...)
+	}
+
+	qc.enforceMu.Unlock()
+
+	qc.notify(events)
+	return events, errors.Join(errs...)
+}
+
+func (qc *QuotaChecker) notify(events []QuotaEvent) {
+	if qc.handler == nil {
+		return
+	}
+	for _, e := range events {
+		qc.handler(e)
+	}
+}
+
+// enforce applies and reverts the actions of q, it must be called with
+// enforceMu held.
+func (qc *QuotaChecker) enforce(q Quota, size int64, breached map[QuotaLevel]bool) []QuotaEvent {
+	state, ok := qc.state[q.Database]
+	if !ok {
+		var err error
+		state, err = qc.loadState(q.Database)
+		if err != nil {
+			return []QuotaEvent{{Time: time.Now(), Database: q.Database, Err: err}}
+		}
+		qc.state[q.Database] = state
+	}
+
+	var events []QuotaEvent
+	event := func(level QuotaLevel, action QuotaAction, reverted bool, err error) {
+		e := QuotaEvent{
+			Time:     time.Now(),
+			Database: q.Database,
+			Level:    level,
+			Size:     size,
+			Limit:    q.limit(level),
+			Action:   action,
+			Reverted: reverted,
+			Err:      err,
+		}
+		events = append(events, e)
+	}
+
+	// Notify about every level that changed state
+	for _, level := range []QuotaLevel{QuotaLevelSoft, QuotaLevelHard} {
+		if breached[level] != state.breached[level] {
+			state.breached[level] = breached[level]
+			event(level, QuotaActionEvent, !breached[level], nil)
+		}
+	}
+
+	// Enforcing actions are shared between levels, an action is only
+	// reverted once no breached level asks for it anymore
+	for _, action := range []QuotaAction{QuotaActionReadOnly, QuotaActionRevokeConnect} {
+		level, wanted := q.wants(action, breached)
+		switch {
+		case wanted && !state.applied[action]:
+			err := qc.apply(q.Database, action, state)
+			if err == nil {
+				state.applied[action] = true
+				err = qc.saveState(q.Database, state)
+			}
+			event(level, action, false, err)
+		case !wanted && state.applied[action]:
+			err := qc.revert(q.Database, action, state)
+			if err == nil {
+				delete(state.applied, action)
+				err = qc.saveState(q.Database, state)
+			}
+			event(level, action, true, err)
+		}
+	}
+
+	return events
+}
+
+func (qc *QuotaChecker) apply(dbName string, action QuotaAction, state *quotaState) error {
+	switch action {
+	case QuotaActionReadOnly:
+		readOnly, err := qc.c.DatabaseReadOnly(dbName)
+		if err != nil {
+			return err
+		}
+		state.wasReadOnly = readOnly
+		if readOnly {
+			return nil
+		}
+		return qc.c.SetDatabaseReadOnly(dbName, true, false)
+	case QuotaActionRevokeConnect:
+		revoked, err := qc.c.revokeDatabaseConnect(dbName)
+		if err != nil {
+			return err
+		}
+		state.revoked = revoked
+	}
+	return nil
+}
+
+func (qc *QuotaChecker) revert(dbName string, action QuotaAction, state *quotaState) error {
+	switch action {
+	case QuotaActionReadOnly:
+		if state.wasReadOnly {
+			state.wasReadOnly = false
+			return nil
+		}
+		return qc.c.SetDatabaseReadOnly(dbName, false, false)
+	case QuotaActionRevokeConnect:
+		err := qc.c.restoreDatabaseConnect(dbName, state.revoked)
+		if err != nil {
+			return err
+		}
+		state.revoked = nil
+	}
+	return nil
+}
+
+// loadState rebuilds the state of dbName from quotaStateSetting, left there
+// by an earlier checker.
+func (qc *QuotaChecker) loadState(dbName string) (*quotaState, error) {
+	state := &quotaState{breached: map[QuotaLevel]bool{}, applied: map[QuotaAction]bool{}}
+
+	settings, err := qc.c.GetDatabaseSettings(dbName)
+	if err != nil {
+		return nil, fmt.Errorf("error loading quota state of %s: %w", dbName, err)
+	}
+	value, ok := settings[quotaStateSetting]
+	if !ok {
+		return state, nil
+	}
+
+	var saved savedQuotaState
+	if err := json.Unmarshal([]byte(value), &saved); err != nil {
+		return nil, fmt.Errorf("error parsing quota state of %s: %w", dbName, err)
+	}
+	for _, action := range saved.Applied {
+		state.applied[action] = true
+	}
+	state.wasReadOnly = saved.WasReadOnly
+	state.revoked = saved.Revoked
+	return state, nil
+}
+
+// saveState records the applied actions of dbName, the setting is removed
+// once nothing is applied anymore.
+func (qc *QuotaChecker) saveState(dbName string, state *quotaState) error {
+	var saved savedQuotaState
+	for _, action := range []QuotaAction{QuotaActionReadOnly, QuotaActionRevokeConnect} {
+		if state.applied[action] {
+			saved.Applied = append(saved.Applied, action)
+		}
+	}
+	if len(saved.Applied) == 0 {
+		return qc.c.ResetDatabaseSetting(dbName, quotaStateSetting)
+	}
+
+	saved.WasReadOnly = state.wasReadOnly
+	saved.Revoked = state.revoked
+	value, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return qc.c.SetDatabaseSetting(dbName, quotaStateSetting, string(value))
+}
+
+func (q Quota) limit(level QuotaLevel) int64 {
+	if level == QuotaLevelHard {
+		return q.HardLimit
+	}
+	return q.SoftLimit
+}
+
+// wants reports whether any breached level includes the action, preferring
+// the hard level. For an unwanted action the hard level is returned.
+func (q Quota) wants(action QuotaAction, breached map[QuotaLevel]bool) (QuotaLevel, bool) {
+	if breached[QuotaLevelHard] && containsAction(q.HardActions, action) {
+		return QuotaLevelHard, true
+	}
+	if breached[QuotaLevelSoft] && containsAction(q.SoftActions, action) {
+		return QuotaLevelSoft, true
+	}
+	return QuotaLevelHard, false
+}
+
+func containsAction(actions []QuotaAction, action QuotaAction) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func validateQuota(q Quota) error {
+	if err := validateDBName(q.Database); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidQuota, err)
+	}
+	if q.SoftLimit < 0 || q.HardLimit < 0 {
+		return fmt.Errorf("%w: negative limit", ErrInvalidQuota)
+	}
+	if q.SoftLimit == 0 && q.HardLimit == 0 {
+		return fmt.Errorf("%w: no limits set", ErrInvalidQuota)
+	}
+	if q.SoftLimit > 0 && q.HardLimit > 0 && q.SoftLimit > q.HardLimit {
+		return fmt.Errorf("%w: soft limit above hard limit", ErrInvalidQuota)
+	}
+
+	for _, action := range append(append([]QuotaAction(nil), q.SoftActions...), q.HardActions...) {
+		switch action {
+		case QuotaActionEvent, QuotaActionReadOnly, QuotaActionRevokeConnect:
+		default:
+			return fmt.Errorf("%w: unknown action %q", ErrInvalidQuota, action)
+		}
+	}
+
+	return nil
+}
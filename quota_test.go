@@ -0,0 +1,229 @@
+// postgresctl/quota_test.go
+package postgresctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateQuota(t *testing.T) {
+	assert.NoError(t, validateQuota(Quota{Database: "tenant", SoftLimit: 10, HardLimit: 20}))
+	assert.NoError(t, validateQuota(Quota{Database: "tenant", HardLimit: 20, HardActions: []QuotaAction{QuotaActionReadOnly}}))
+
+	assert.ErrorIs(t, validateQuota(Quota{Database: "", HardLimit: 20}), ErrInvalidQuota)
+	assert.ErrorIs(t, validateQuota(Quota{Database: "postgres", HardLimit: 20}), ErrInvalidQuota)
+	assert.ErrorIs(t, validateQuota(Quota{Database: "tenant"}), ErrInvalidQuota)
+	assert.ErrorIs(t, validateQuota(Quota{Database: "tenant", SoftLimit: 30, HardLimit: 20}), ErrInvalidQuota)
+	assert.ErrorIs(t, validateQuota(Quota{Database: "tenant", HardLimit: -1}), ErrInvalidQuota)
+	assert.ErrorIs(t, validateQuota(Quota{Database: "tenant", HardLimit: 20, HardActions: []QuotaAction{"drop"}}), ErrInvalidQuota)
+}
+
+func TestQuotaChecker_Enforcement(t *testing.T) {
+	testDB := testDB()
+	testUser := testUser()
+	testPassword := testPassword()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateUser(testUser, testPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	// Any database is bigger than a byte
+	quota := Quota{
+		Database:    testDB,
+		SoftLimit:   1,
+		HardLimit:   2,
+		SoftActions: []QuotaAction{QuotaActionEvent},
+		HardActions: []QuotaAction{QuotaActionReadOnly, QuotaActionRevokeConnect},
+	}
+
+	var handled []QuotaEvent
+	qc, err := NewQuotaChecker(c, []Quota{quota}, WithQuotaHandler(func(e QuotaEvent) {
+		handled = append(handled, e)
+	}))
+	assert.NoError(t, err)
+
+	events, err := qc.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, events, handled)
+	assert.Equal(t, 4, len(events))
+	for _, e := range events {
+		assert.NoError(t, e.Err)
+		assert.False(t, e.Reverted)
+	}
+
+	err = openPostgres(testUser, testPassword, testDB)
+	assert.Error(t, err, "CONNECT should be revoked on hard breach")
+
+	var readOnly bool
+	err = c.db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM pg_db_role_setting s
+			JOIN pg_database d ON d.oid = s.setdatabase
+			WHERE d.datname = $1 AND s.setrole = 0
+			AND 'default_transaction_read_only=on' = ANY(s.setconfig)
+		)`, testDB).Scan(&readOnly)
+	assert.NoError(t, err)
+	assert.True(t, readOnly)
+
+	// Nothing changes while the breach persists
+	events, err = qc.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(events))
+
+	// Raising the hard limit reverts enforcement but keeps the soft breach
+	quota.HardLimit = 1 << 40
+	err = qc.SetQuota(quota)
+	assert.NoError(t, err)
+
+	events, err = qc.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(events))
+	for _, e := range events {
+		assert.NoError(t, e.Err)
+		assert.True(t, e.Reverted)
+	}
+
+	err = openPostgres(testUser, testPassword, testDB)
+	assert.NoError(t, err, "CONNECT should be restored")
+
+	events = qc.RemoveQuota(testDB)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, QuotaLevelSoft, events[0].Level)
+	assert.True(t, events[0].Reverted)
+}
+
+func TestQuotaChecker_KeepsReadOnly(t *testing.T) {
+	testDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	err = c.SetDatabaseReadOnly(testDB, true, false)
+	assert.NoError(t, err)
+
+	quota := Quota{
+		Database:    testDB,
+		HardLimit:   1,
+		HardActions: []QuotaAction{QuotaActionReadOnly},
+	}
+	qc, err := NewQuotaChecker(c, []Quota{quota})
+	assert.NoError(t, err)
+
+	_, err = qc.Check()
+	assert.NoError(t, err)
+
+	events := qc.RemoveQuota(testDB)
+	assert.Equal(t, 2, len(events))
+	for _, e := range events {
+		assert.NoError(t, e.Err)
+		assert.True(t, e.Reverted)
+	}
+
+	readOnly, err := c.DatabaseReadOnly(testDB)
+	assert.NoError(t, err)
+	assert.True(t, readOnly, "a database read-only before the breach should stay read-only")
+}
+
+func TestQuotaChecker_HandlerChangesQuotas(t *testing.T) {
+	testDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	var qc *QuotaChecker
+	var removed []QuotaEvent
+	qc, err = NewQuotaChecker(c, []Quota{{Database: testDB, HardLimit: 1}}, WithQuotaHandler(func(e QuotaEvent) {
+		if !e.Reverted {
+			removed = qc.RemoveQuota(e.Database)
+		}
+	}))
+	assert.NoError(t, err)
+
+	events, err := qc.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, 1, len(removed))
+	assert.True(t, removed[0].Reverted)
+}
+
+func TestQuotaChecker_RevertsAfterRestart(t *testing.T) {
+	testDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	quota := Quota{
+		Database:    testDB,
+		HardLimit:   1,
+		HardActions: []QuotaAction{QuotaActionReadOnly},
+	}
+	qc, err := NewQuotaChecker(c, []Quota{quota})
+	assert.NoError(t, err)
+
+	_, err = qc.Check()
+	assert.NoError(t, err)
+
+	readOnly, err := c.DatabaseReadOnly(testDB)
+	assert.NoError(t, err)
+	assert.True(t, readOnly)
+
+	// A new checker picks up what the first one applied
+	quota.HardLimit = 1 << 40
+	qc, err = NewQuotaChecker(c, []Quota{quota})
+	assert.NoError(t, err)
+
+	events, err := qc.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, QuotaActionReadOnly, events[0].Action)
+	assert.True(t, events[0].Reverted)
+	assert.NoError(t, events[0].Err)
+
+	readOnly, err = c.DatabaseReadOnly(testDB)
+	assert.NoError(t, err)
+	assert.False(t, readOnly)
+
+	settings, err := c.GetDatabaseSettings(testDB)
+	assert.NoError(t, err)
+	assert.NotContains(t, settings, quotaStateSetting)
+}
+
+func TestQuotaChecker_ReportsFailedDatabases(t *testing.T) {
+	testDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	var handled []QuotaEvent
+	qc, err := NewQuotaChecker(c, []Quota{{Database: testDB, HardLimit: 1}}, WithQuotaHandler(func(e QuotaEvent) {
+		handled = append(handled, e)
+	}))
+	assert.NoError(t, err)
+
+	events, err := qc.Check()
+	assert.Error(t, err)
+	assert.Equal(t, events, handled)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, testDB, events[0].Database)
+	assert.Error(t, events[0].Err)
+}
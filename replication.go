@@ -0,0 +1,499 @@
+// postgresctl/replication.go
+package postgresctl
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type ReplicationController interface {
+	CreatePublication(dbName, name string, tables []string) error
+	DropPublication(dbName, name string) error
+	ListPublications(dbName string) ([]Publication, error)
+	CreateSubscription(dbName, name string, source PostgresConn, publication string) error
+	DropSubscription(dbName, name string) error
+	ListReplicationSlots() ([]ReplicationSlot, error)
+	DropReplicationSlot(name string) error
+	ReplicationLag() (ReplicationLagReport, error)
+	ServerRole() (ServerRole, error)
+	ReplicationStatus() (ReplicationStatus, error)
+}
+
+var _ ReplicationController = &PostgresController{}
+
+var (
+	ErrPublicationExists            = fmt.Errorf("publication exists")
+	ErrPublicationDoesNotExist      = fmt.Errorf("publication does not exist")
+	ErrSubscriptionExists           = fmt.Errorf("subscription exists")
+	ErrSubscriptionDoesNotExist     = fmt.Errorf("subscription does not exist")
+	ErrReplicationSlotExists        = fmt.Errorf("replication slot exists")
+	ErrReplicationSlotDoesNotExist  = fmt.Errorf("replication slot does not exist")
+	ErrReplicationSlotActive        = fmt.Errorf("replication slot is active")
+	ErrInvalidReplicationObjectName = fmt.Errorf("invalid replication object name")
+)
+
+// Slot names are limited to these characters, publications and
+// subscriptions use the same rules so they can share a slot's name
+var replicationNameRe = regexp.MustCompile(`^[a-z0-9_]{1,63}$`)
+
+type Publication struct {
+	Name      string
+	Owner     string
+	AllTables bool
+	// Tables as schema.table, empty for AllTables
+	Tables []string
+}
+
+type ReplicationSlot struct {
+	Name     string
+	Plugin   string
+	SlotType string
+	Database string
+	Active   bool
+	// LSNs in their text form, empty when not set
+	RestartLSN        string
+	ConfirmedFlushLSN string
+	// Bytes of WAL the slot holds back
+	RetainedBytes int64
+}
+
+// ReplicationSender is a row of pg_stat_replication, a walsender serving a
+// standby or a subscription.
+type ReplicationSender struct {
+	PID             int
+	ApplicationName string
+	ClientAddr      string
+	State           string
+	SentLSN         string
+	ReplayLSN       string
+	// Bytes between the current WAL position and the replayed one, on a
+	// cascading standby the position is the last WAL received
+	LagBytes  int64
+	ReplayLag time.Duration
+}
+
+// SubscriptionStatus is the apply worker of a subscription on this server.
+type SubscriptionStatus struct {
+	Name    string
+	Enabled bool
+	// Zero when no worker is running
+	PID                 int
+	ReceivedLSN         string
+	LatestEndLSN        string
+	LastMessageReceived time.Time
+}
+
+// ReplicationLagReport combines the sending side (senders and slots) with
+// the receiving side (subscriptions) of this server.
+type ReplicationLagReport struct {
+	Senders       []ReplicationSender
+	Slots         []ReplicationSlot
+	Subscriptions []SubscriptionStatus
+}
+
+// CreatePublication publishes tables ("schema.table" or "table" for public)
+// of dbName, or every table when tables is empty.
+func (c *PostgresController) CreatePublication(dbName, name string, tables []string) error {
+	if err := validateDBName(dbName); err != nil {
+		return err
+	}
+	if err := validateReplicationName(name); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	target := "FOR ALL TABLES"
+	if len(tables) > 0 {
+		quoted := make([]string, len(tables))
+		for i, table := range tables {
+			quoted[i] = quoteQualifiedName(table)
+		}
+		target = "FOR TABLE " + strings.Join(quoted, ", ")
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE PUBLICATION "` + name + `" ` + target)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return ErrPublicationExists
+		}
+		return fmt.Errorf("error creating publication: %w", err)
+	}
+	return nil
+}
+
+func (c *PostgresController) DropPublication(dbName, name string) error {
+	if err := validateDBName(dbName); err != nil {
+		return err
+	}
+	if err := validateReplicationName(name); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DROP PUBLICATION "` + name + `"`)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			return ErrPublicationDoesNotExist
+		}
+		return fmt.Errorf("error dropping publication: %w", err)
+	}
+	return nil
+}
+
+func (c *PostgresController) ListPublications(dbName string) ([]Publication, error) {
+	if err := validateDBName(dbName); err != nil {
+		return nil, err
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT p.pubname, pg_catalog.pg_get_userbyid(p.pubowner), p.puballtables,
+			COALESCE(array_agg(format('%s.%s', t.schemaname, t.tablename) ORDER BY t.schemaname, t.tablename)
+				FILTER (WHERE NOT p.puballtables AND t.tablename IS NOT NULL), '{}')
+		FROM pg_publication p
+		LEFT JOIN pg_publication_tables t ON t.pubname = p.pubname
+		GROUP BY p.pubname, p.pubowner, p.puballtables
+		ORDER BY p.pubname
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing publications: %w", err)
+	}
+	defer rows.Close()
+
+	var publications []Publication
+	for rows.Next() {
+		var p Publication
+		if err := rows.Scan(&p.Name, &p.Owner, &p.AllTables, pq.Array(&p.Tables)); err != nil {
+			return nil, fmt.Errorf("error scanning publication: %w", err)
+		}
+		publications = append(publications, p)
+	}
+
+	return publications, rows.Err()
+}
+
+// CreateSubscription subscribes dbName to a publication on source. The
+// replication slot is created on the source up front rather than by CREATE
+// SUBSCRIPTION, which would hang when source is on the same server. The
+// slot gets the subscription's name. Tables must already exist in dbName.
+func (c *PostgresController) CreateSubscription(dbName, name string, source PostgresConn, publication string) error {
+	if err := validateDBName(dbName); err != nil {
+		return err
+	}
+	if err := validateReplicationName(name); err != nil {
+		return err
+	}
+	if err := validateReplicationName(publication); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	srcDB, err := sql.Open("postgres", source.connStr())
+	if err != nil {
+		return fmt.Errorf("failed to connect to source: %w", err)
+	}
+	defer srcDB.Close()
+
+	_, err = srcDB.Exec(`SELECT pg_catalog.pg_create_logical_replication_slot($1, 'pgoutput')`, name)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return ErrReplicationSlotExists
+		}
+		return fmt.Errorf("error creating replication slot: %w", err)
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		_, _ = srcDB.Exec(`SELECT pg_catalog.pg_drop_replication_slot($1)`, name)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE SUBSCRIPTION "` + name + `"` +
+		` CONNECTION ` + quoteLiteral(source.keywordConnStr()) +
+		` PUBLICATION "` + publication + `"` +
+		` WITH (create_slot = false, slot_name = ` + quoteLiteral(name) + `)`)
+	if err != nil {
+		_, _ = srcDB.Exec(`SELECT pg_catalog.pg_drop_replication_slot($1)`, name)
+		if strings.Contains(err.Error(), "already exists") {
+			return ErrSubscriptionExists
+		}
+		return fmt.Errorf("error creating subscription: %w", err)
+	}
+	return nil
+}
+
+// DropSubscription drops a subscription of dbName and its replication slot
+// on the source. The slot is detached before the drop and removed
+// separately, so it also works when the source is on the same server.
+func (c *PostgresController) DropSubscription(dbName, name string) error {
+	if err := validateDBName(dbName); err != nil {
+		return err
+	}
+	if err := validateReplicationName(name); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var conninfo string
+	var slot sql.NullString
+	err = db.QueryRow(`
+		SELECT subconninfo, subslotname
+		FROM pg_subscription
+		WHERE subname = $1
+		AND subdbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+	`, name).Scan(&conninfo, &slot)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrSubscriptionDoesNotExist
+		}
+		return fmt.Errorf("error getting subscription: %w", err)
+	}
+
+	for _, stmt := range []string{
+		`ALTER SUBSCRIPTION "` + name + `" DISABLE`,
+		`ALTER SUBSCRIPTION "` + name + `" SET (slot_name = NONE)`,
+		`DROP SUBSCRIPTION "` + name + `"`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("error dropping subscription: %w", err)
+		}
+	}
+
+	if !slot.Valid {
+		return nil
+	}
+
+	srcDB, err := sql.Open("postgres", conninfo)
+	if err != nil {
+		return fmt.Errorf("failed to connect to source: %w", err)
+	}
+	defer srcDB.Close()
+
+	// The apply worker may take a moment to release the slot
+	for attempt := 0; ; attempt++ {
+		err = dropReplicationSlot(srcDB, slot.String)
+		if err != ErrReplicationSlotActive || attempt == 10 {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	if err == ErrReplicationSlotDoesNotExist {
+		return nil
+	}
+	return err
+}
+
+// currentWALPosition is the latest WAL position of the server.
+// pg_current_wal_lsn() fails during recovery, a standby uses the last WAL it
+// received, or replayed when it doesn't stream.
+const currentWALPosition = `CASE WHEN pg_catalog.pg_is_in_recovery()
+	THEN COALESCE(pg_catalog.pg_last_wal_receive_lsn(), pg_catalog.pg_last_wal_replay_lsn())
+	ELSE pg_catalog.pg_current_wal_lsn() END`
+
+func (c *PostgresController) ListReplicationSlots() ([]ReplicationSlot, error) {
+	rows, err := c.db.Query(`
+		SELECT slot_name, COALESCE(plugin, ''), slot_type, COALESCE(database, ''), active,
+			COALESCE(restart_lsn::text, ''), COALESCE(confirmed_flush_lsn::text, ''),
+			COALESCE(pg_catalog.pg_wal_lsn_diff(` + currentWALPosition + `, restart_lsn)::bigint, 0)
+		FROM pg_replication_slots
+		ORDER BY slot_name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing replication slots: %w", err)
+	}
+	defer rows.Close()
+
+	var slots []ReplicationSlot
+	for rows.Next() {
+		var s ReplicationSlot
+		err := rows.Scan(&s.Name, &s.Plugin, &s.SlotType, &s.Database, &s.Active, &s.RestartLSN, &s.ConfirmedFlushLSN, &s.RetainedBytes)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning replication slot: %w", err)
+		}
+		slots = append(slots, s)
+	}
+
+	return slots, rows.Err()
+}
+
+func (c *PostgresController) DropReplicationSlot(name string) error {
+	if err := validateReplicationName(name); err != nil {
+		return err
+	}
+	return dropReplicationSlot(c.db, name)
+}
+
+func dropReplicationSlot(db *sql.DB, name string) error {
+	_, err := db.Exec(`SELECT pg_catalog.pg_drop_replication_slot($1)`, name)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "does not exist"):
+			return ErrReplicationSlotDoesNotExist
+		case strings.Contains(err.Error(), "is active"):
+			return ErrReplicationSlotActive
+		}
+		return fmt.Errorf("error dropping replication slot: %w", err)
+	}
+	return nil
+}
+
+func (c *PostgresController) ReplicationLag() (ReplicationLagReport, error) {
+	var report ReplicationLagReport
+
+	rows, err := c.db.Query(`
+		SELECT pid, application_name, COALESCE(host(client_addr), ''), state,
+			COALESCE(sent_lsn::text, ''), COALESCE(replay_lsn::text, ''),
+			COALESCE(pg_catalog.pg_wal_lsn_diff(` + currentWALPosition + `, replay_lsn)::bigint, 0),
+			COALESCE(EXTRACT(EPOCH FROM replay_lag), 0)
+		FROM pg_stat_replication
+		ORDER BY application_name, pid
+	`)
+	if err != nil {
+		return report, fmt.Errorf("error getting replication senders: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s ReplicationSender
+		var replayLag float64
+		err := rows.Scan(&s.PID, &s.ApplicationName, &s.ClientAddr, &s.State, &s.SentLSN, &s.ReplayLSN, &s.LagBytes, &replayLag)
+		if err != nil {
+			return report, fmt.Errorf("error scanning replication sender: %w", err)
+		}
+		s.ReplayLag = time.Duration(replayLag * float64(time.Second))
+		report.Senders = append(report.Senders, s)
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	report.Slots, err = c.ListReplicationSlots()
+	if err != nil {
+		return report, err
+	}
+
+	caps, err := c.Capabilities()
+	if err != nil {
+		return report, err
+	}
+
+	// Table sync workers have a relid and parallel apply workers (PostgreSQL
+	// 16+) a leader_pid, only the leader apply worker is reported
+	applyWorker := `st.relid IS NULL`
+	if caps.VersionNum >= postgres16 {
+		applyWorker += ` AND st.leader_pid IS NULL`
+	}
+	subRows, err := c.db.Query(`
+		SELECT s.subname, s.subenabled, COALESCE(st.pid, 0),
+			COALESCE(st.received_lsn::text, ''), COALESCE(st.latest_end_lsn::text, ''),
+			st.last_msg_receipt_time
+		FROM pg_subscription s
+		LEFT JOIN pg_stat_subscription st ON st.subid = s.oid AND ` + applyWorker + `
+		ORDER BY s.subname
+	`)
+	if err != nil {
+		return report, fmt.Errorf("error getting subscriptions: %w", err)
+	}
+	defer subRows.Close()
+
+	for subRows.Next() {
+		var s SubscriptionStatus
+		var received sql.NullTime
+		err := subRows.Scan(&s.Name, &s.Enabled, &s.PID, &s.ReceivedLSN, &s.LatestEndLSN, &received)
+		if err != nil {
+			return report, fmt.Errorf("error scanning subscription: %w", err)
+		}
+		s.LastMessageReceived = received.Time
+		report.Subscriptions = append(report.Subscriptions, s)
+	}
+
+	return report, subRows.Err()
+}
+
+// keywordConnStr returns pc as libpq key/value pairs, the form CREATE
+// SUBSCRIPTION stores and the source server can parse.
+func (pc PostgresConn) keywordConnStr() string {
+	sslMode := pc.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	pairs := []struct{ key, value string }{
+		{"host", pc.Host},
+		{"port", strconv.Itoa(pc.Port)},
+		{"user", pc.Username},
+		{"password", pc.Password},
+		{"dbname", pc.Database},
+		{"sslmode", sslMode},
+	}
+
+	var parts []string
+	for _, p := range pairs {
+		if p.value == "" {
+			continue
+		}
+		value := strings.ReplaceAll(p.value, `\`, `\\`)
+		value = strings.ReplaceAll(value, `'`, `\'`)
+		parts = append(parts, p.key+"='"+value+"'")
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteQualifiedName quotes "schema.table", a name without a schema is
+// taken from public.
+func quoteQualifiedName(name string) string {
+	schema, table, ok := strings.Cut(name, ".")
+	if !ok {
+		schema, table = "public", name
+	}
+	return quoteIdent(schema) + "." + quoteIdent(table)
+}
+
+func validateReplicationName(name string) error {
+	if !replicationNameRe.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidReplicationObjectName, name)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// postgresctl/replication_test.go
+package postgresctl
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeywordConnStr(t *testing.T) {
+	conn := PostgresConn{Host: "localhost", Port: 5432, Username: "repl", Password: `it's a \ secret`, Database: "tenant"}
+	assert.Equal(t, `host='localhost' port='5432' user='repl' password='it\'s a \\ secret' dbname='tenant' sslmode='disable'`, conn.keywordConnStr())
+
+	assert.Equal(t, `"public"."items"`, quoteQualifiedName("items"))
+	assert.Equal(t, `"app"."order""s"`, quoteQualifiedName(`app.order"s`))
+
+	assert.NoError(t, validateReplicationName("tenant_move_1"))
+	assert.ErrorIs(t, validateReplicationName("Tenant"), ErrInvalidReplicationObjectName)
+	assert.ErrorIs(t, validateReplicationName(""), ErrInvalidReplicationObjectName)
+}
+
+func TestPostgresController_LogicalReplication(t *testing.T) {
+	c := createTestController()
+	defer c.Close()
+
+	var walLevel string
+	err := c.db.QueryRow(`SHOW wal_level`).Scan(&walLevel)
+	assert.NoError(t, err)
+	if walLevel != "logical" {
+		t.Skip("logical replication requires wal_level=logical")
+	}
+
+	srcDB := testDB()
+	dstDB := testDB()
+	name := "pgctl_test_" + strings.ToLower(randomString(8))
+
+	for _, db := range []string{srcDB, dstDB} {
+		err = c.CreateDatabase(db)
+		assert.NoError(t, err)
+		defer c.DeleteDatabase(db)
+
+		conn, err := c.openDB(db)
+		assert.NoError(t, err)
+		_, err = conn.Exec(`CREATE TABLE items (id int PRIMARY KEY, name text)`)
+		assert.NoError(t, err)
+		conn.Close()
+	}
+
+	src, err := c.openDB(srcDB)
+	assert.NoError(t, err)
+	defer src.Close()
+	_, err = src.Exec(`INSERT INTO items SELECT i, 'item ' || i FROM generate_series(1, 100) i`)
+	assert.NoError(t, err)
+
+	err = c.CreatePublication(srcDB, name, []string{"items"})
+	assert.NoError(t, err)
+	err = c.CreatePublication(srcDB, name, nil)
+	assert.Equal(t, ErrPublicationExists, err)
+
+	publications, err := c.ListPublications(srcDB)
+	assert.NoError(t, err)
+	assert.Equal(t, []Publication{{Name: name, Owner: pc.Username, Tables: []string{"public.items"}}}, publications)
+
+	source := pc
+	source.Database = srcDB
+	err = c.CreateSubscription(dstDB, name, source, name)
+	assert.NoError(t, err)
+
+	dst, err := c.openDB(dstDB)
+	assert.NoError(t, err)
+	defer dst.Close()
+
+	// Initial sync, then streaming of new rows
+	_, err = src.Exec(`INSERT INTO items VALUES (101, 'late')`)
+	assert.NoError(t, err)
+
+	var count int
+	assert.Eventually(t, func() bool {
+		return dst.QueryRow(`SELECT count(*) FROM items`).Scan(&count) == nil && count == 101
+	}, 30*time.Second, 200*time.Millisecond)
+
+	slots, err := c.ListReplicationSlots()
+	assert.NoError(t, err)
+	var found bool
+	for _, s := range slots {
+		if s.Name == name {
+			found = true
+			assert.Equal(t, "pgoutput", s.Plugin)
+			assert.Equal(t, "logical", s.SlotType)
+			assert.Equal(t, srcDB, s.Database)
+		}
+	}
+	assert.True(t, found)
+
+	err = c.DropReplicationSlot(name)
+	assert.Equal(t, ErrReplicationSlotActive, err)
+
+	report, err := c.ReplicationLag()
+	assert.NoError(t, err)
+	var subscription *SubscriptionStatus
+	for i := range report.Subscriptions {
+		if report.Subscriptions[i].Name == name {
+			subscription = &report.Subscriptions[i]
+		}
+	}
+	if assert.NotNil(t, subscription) {
+		assert.True(t, subscription.Enabled)
+		assert.NotZero(t, subscription.PID)
+	}
+	var sender bool
+	for _, s := range report.Senders {
+		sender = sender || s.ApplicationName == name
+	}
+	assert.True(t, sender)
+
+	err = c.DropSubscription(dstDB, name)
+	assert.NoError(t, err)
+	err = c.DropSubscription(dstDB, name)
+	assert.Equal(t, ErrSubscriptionDoesNotExist, err)
+
+	err = c.DropReplicationSlot(name)
+	assert.Equal(t, ErrReplicationSlotDoesNotExist, err, "slot should be dropped with the subscription")
+
+	err = c.DropPublication(srcDB, name)
+	assert.NoError(t, err)
+	err = c.DropPublication(srcDB, name)
+	assert.Equal(t, ErrPublicationDoesNotExist, err)
+}
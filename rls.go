@@ -0,0 +1,340 @@
+// postgresctl/rls.go
+package postgresctl
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// RLSController manages row-level security. Tables are "table" or
+// "schema.table", the schema defaults to public.
+type RLSController interface {
+	EnableRLS(dbName, table string, force bool) error
+	DisableRLS(dbName, table string) error
+	CreatePolicy(dbName, table string, spec PolicySpec) error
+	DropPolicy(dbName, table, name string) error
+	ListPolicies(dbName, table string) ([]Policy, error)
+	CreateTenantPolicy(dbName, table string, roles []string) error
+}
+
+var _ RLSController = &PostgresController{}
+
+type PolicyCommand string
+
+const (
+	PolicyCommandAll    PolicyCommand = "ALL"
+	PolicyCommandSelect PolicyCommand = "SELECT"
+	PolicyCommandInsert PolicyCommand = "INSERT"
+	PolicyCommandUpdate PolicyCommand = "UPDATE"
+	PolicyCommandDelete PolicyCommand = "DELETE"
+)
+
+const (
+	// Name, column and setting used by CreateTenantPolicy
+	TenantPolicyName    = "tenant_isolation"
+	TenantIDColumn      = "tenant_id"
+	TenantIDSetting     = "app.tenant_id"
+	maxPolicyNameLength = 63
+)
+
+var (
+	ErrPolicyExists       = fmt.Errorf("policy exists")
+	ErrPolicyDoesNotExist = fmt.Errorf("policy does not exist")
+	ErrInvalidPolicy      = fmt.Errorf("invalid policy")
+)
+
+// PolicySpec describes a policy. Using and WithCheck are SQL expressions and
+// are used as is, at least one of them is required. Policies are permissive
+// unless Restrictive is set, as in PostgreSQL.
+type PolicySpec struct {
+	Name string
+	// Command defaults to ALL
+	Command PolicyCommand
+	// Roles are role names or PUBLIC, empty means PUBLIC
+	Roles       []string
+	Using       string
+	WithCheck   string
+	Restrictive bool
+}
+
+type Policy struct {
+	Schema    string
+	Table     string
+	Name      string
+	Command   PolicyCommand
+	Roles     []string
+	Using     string
+	WithCheck string
+	// Permissive is false for restrictive policies
+	Permissive bool
+}
+
+// EnableRLS turns on row-level security for table. Table owners bypass
+// policies unless force is set.
+func (c *PostgresController) EnableRLS(dbName, table string, force bool) error {
+	stmts := []string{"ALTER TABLE " + quoteQualifiedName(table) + " ENABLE ROW LEVEL SECURITY"}
+	if force {
+		stmts = append(stmts, "ALTER TABLE "+quoteQualifiedName(table)+" FORCE ROW LEVEL SECURITY")
+	} else {
+		stmts = append(stmts, "ALTER TABLE "+quoteQualifiedName(table)+" NO FORCE ROW LEVEL SECURITY")
+	}
+	return c.execRLS(dbName, stmts)
+}
+
+// DisableRLS turns off row-level security for table, its policies are kept
+func (c *PostgresController) DisableRLS(dbName, table string) error {
+	return c.execRLS(dbName, []string{
+		"ALTER TABLE " + quoteQualifiedName(table) + " DISABLE ROW LEVEL SECURITY",
+		"ALTER TABLE " + quoteQualifiedName(table) + " NO FORCE ROW LEVEL SECURITY",
+	})
+}
+
+// CreatePolicy creates a policy on table. It doesn't enable row-level
+// security, see EnableRLS.
+func (c *PostgresController) CreatePolicy(dbName, table string, spec PolicySpec) error {
+	stmt, err := spec.createSQL(table)
+	if err != nil {
+		return err
+	}
+	return c.execRLS(dbName, []string{stmt})
+}
+
+func (c *PostgresController) DropPolicy(dbName, table, name string) error {
+	if err := validatePolicyName(name); err != nil {
+		return err
+	}
+	return c.execRLS(dbName, []string{"DROP POLICY " + quoteIdent(name) + " ON " + quoteQualifiedName(table)})
+}
+
+// CreateTenantPolicy isolates tenants sharing table. It forces row-level
+// security and creates a policy for roles (PUBLIC when empty) letting them
+// read and write only rows whose tenant_id equals the app.tenant_id setting:
+//
+//	SET app.tenant_id = '42';
+//
+// No rows are visible while the setting is unset.
+func (c *PostgresController) CreateTenantPolicy(dbName, table string, roles []string) error {
+	if err := validateDBName(dbName); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var columnType string
+	err = db.QueryRow(`
+		SELECT pg_catalog.format_type(a.atttypid, a.atttypmod)
+		FROM pg_attribute a
+		WHERE a.attrelid = $1::regclass AND a.attname = $2
+		AND a.attnum > 0 AND NOT a.attisdropped
+	`, quoteQualifiedName(table), TenantIDColumn).Scan(&columnType)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %s.%s", ErrColumnDoesNotExist, table, TenantIDColumn)
+	}
+	if err != nil {
+		return rlsError(err)
+	}
+
+	// current_setting is empty rather than NULL after RESET, which a cast to
+	// e.g. int would reject
+	condition := quoteIdent(TenantIDColumn) + " = NULLIF(current_setting(" + quoteLiteral(TenantIDSetting) + ", true), '')::" + columnType
+	policy, err := PolicySpec{
+		Name:      TenantPolicyName,
+		Command:   PolicyCommandAll,
+		Roles:     roles,
+		Using:     condition,
+		WithCheck: condition,
+	}.createSQL(table)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		"ALTER TABLE " + quoteQualifiedName(table) + " ENABLE ROW LEVEL SECURITY",
+		"ALTER TABLE " + quoteQualifiedName(table) + " FORCE ROW LEVEL SECURITY",
+		policy,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return rlsError(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing tenant policy: %w", err)
+	}
+	return nil
+}
+
+// ListPolicies lists the policies on table, or on every table when table is empty
+func (c *PostgresController) ListPolicies(dbName, table string) ([]Policy, error) {
+	if err := validateDBName(dbName); err != nil {
+		return nil, err
+	}
+
+	var schema string
+	if table != "" {
+		var ok bool
+		schema, table, ok = strings.Cut(table, ".")
+		if !ok {
+			schema, table = "public", schema
+		}
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT schemaname, tablename, policyname, cmd, roles::text[],
+			COALESCE(qual, ''), COALESCE(with_check, ''), permissive = 'PERMISSIVE'
+		FROM pg_policies
+		WHERE $1 = '' OR (schemaname = $1 AND tablename = $2)
+		ORDER BY schemaname, tablename, policyname
+	`, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("error listing policies: %w", err)
+	}
+	defer rows.Close()
+
+	var policies []Policy
+	for rows.Next() {
+		var p Policy
+		var command string
+		err := rows.Scan(&p.Schema, &p.Table, &p.Name, &command, pq.Array(&p.Roles), &p.Using, &p.WithCheck, &p.Permissive)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning policy: %w", err)
+		}
+		p.Command = PolicyCommand(command)
+		policies = append(policies, p)
+	}
+
+	return policies, rows.Err()
+}
+
+func (s PolicySpec) createSQL(table string) (string, error) {
+	if err := validatePolicyName(s.Name); err != nil {
+		return "", err
+	}
+
+	command := PolicyCommand(strings.ToUpper(string(s.Command)))
+	switch command {
+	case "":
+		command = PolicyCommandAll
+	case PolicyCommandAll, PolicyCommandSelect, PolicyCommandInsert, PolicyCommandUpdate, PolicyCommandDelete:
+	default:
+		return "", fmt.Errorf("%w: unknown command %q", ErrInvalidPolicy, s.Command)
+	}
+
+	if s.Using == "" && s.WithCheck == "" {
+		return "", fmt.Errorf("%w: USING or WITH CHECK is required", ErrInvalidPolicy)
+	}
+	// PostgreSQL rejects these combinations with a less helpful message
+	if s.WithCheck != "" && (command == PolicyCommandSelect || command == PolicyCommandDelete) {
+		return "", fmt.Errorf("%w: %s policies can't have WITH CHECK", ErrInvalidPolicy, command)
+	}
+	if s.Using != "" && command == PolicyCommandInsert {
+		return "", fmt.Errorf("%w: INSERT policies can't have USING", ErrInvalidPolicy)
+	}
+
+	roles := []string{"PUBLIC"}
+	if len(s.Roles) > 0 {
+		roles = roles[:0]
+		for _, role := range s.Roles {
+			quoted, err := quoteGrantee(role)
+			if err != nil {
+				return "", err
+			}
+			roles = append(roles, quoted)
+		}
+	}
+
+	mode := "PERMISSIVE"
+	if s.Restrictive {
+		mode = "RESTRICTIVE"
+	}
+
+	stmt := "CREATE POLICY " + quoteIdent(s.Name) + " ON " + quoteQualifiedName(table) +
+		" AS " + mode + " FOR " + string(command) + " TO " + strings.Join(roles, ", ")
+	if s.Using != "" {
+		stmt += " USING (" + s.Using + ")"
+	}
+	if s.WithCheck != "" {
+		stmt += " WITH CHECK (" + s.WithCheck + ")"
+	}
+	return stmt, nil
+}
+
+func (c *PostgresController) execRLS(dbName string, stmts []string) error {
+	if err := validateDBName(dbName); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// EnableRLS and DisableRLS change two settings, don't leave one behind
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return rlsError(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing row-level security change: %w", err)
+	}
+	return nil
+}
+
+func rlsError(err error) error {
+	// Not e.g. `column "x" of relation "y" does not exist`
+	relation := strings.HasPrefix(strings.TrimPrefix(err.Error(), "pq: "), "relation ")
+	switch {
+	case relation && strings.Contains(err.Error(), "does not exist"):
+		return fmt.Errorf("%w: %w", ErrObjectDoesNotExist, err)
+	case strings.Contains(err.Error(), "role") && strings.Contains(err.Error(), "does not exist"):
+		return fmt.Errorf("%w: %w", ErrUserDoesNotExist, err)
+	case strings.Contains(err.Error(), "policy") && strings.Contains(err.Error(), "already exists"):
+		return ErrPolicyExists
+	case strings.Contains(err.Error(), "policy") && strings.Contains(err.Error(), "does not exist"):
+		return ErrPolicyDoesNotExist
+	}
+	return fmt.Errorf("error changing row-level security: %w", err)
+}
+
+func validatePolicyName(name string) error {
+	if name == "" || len(name) > maxPolicyNameLength {
+		return fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidPolicy, maxPolicyNameLength)
+	}
+	return nil
+}
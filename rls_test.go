@@ -0,0 +1,139 @@
+// postgresctl/rls_test.go
+package postgresctl
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicySpec_createSQL(t *testing.T) {
+	stmt, err := PolicySpec{Name: "own_rows", Using: "owner = current_user"}.createSQL("documents")
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE POLICY "own_rows" ON "public"."documents" AS PERMISSIVE FOR ALL TO PUBLIC USING (owner = current_user)`, stmt)
+
+	stmt, err = PolicySpec{
+		Name:        "no_archived",
+		Command:     "update",
+		Roles:       []string{"app", "public"},
+		Using:       "NOT archived",
+		WithCheck:   "NOT archived",
+		Restrictive: true,
+	}.createSQL("crm.documents")
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE POLICY "no_archived" ON "crm"."documents" AS RESTRICTIVE FOR UPDATE TO "app", PUBLIC USING (NOT archived) WITH CHECK (NOT archived)`, stmt)
+
+	_, err = PolicySpec{Name: "p"}.createSQL("documents")
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+	_, err = PolicySpec{Name: "p", Command: "MERGE", Using: "true"}.createSQL("documents")
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+	_, err = PolicySpec{Name: "p", Command: PolicyCommandSelect, WithCheck: "true"}.createSQL("documents")
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+	_, err = PolicySpec{Name: "p", Command: PolicyCommandInsert, Using: "true"}.createSQL("documents")
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+	_, err = PolicySpec{Using: "true"}.createSQL("documents")
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+}
+
+func TestRLSError(t *testing.T) {
+	assert.ErrorIs(t, rlsError(fmt.Errorf(`pq: relation "public.documents" does not exist`)), ErrObjectDoesNotExist)
+	assert.ErrorIs(t, rlsError(fmt.Errorf(`pq: role "app" does not exist`)), ErrUserDoesNotExist)
+	assert.ErrorIs(t, rlsError(fmt.Errorf(`pq: policy "p" for table "documents" already exists`)), ErrPolicyExists)
+
+	err := rlsError(fmt.Errorf(`pq: column "owner" of relation "documents" does not exist`))
+	assert.NotErrorIs(t, err, ErrObjectDoesNotExist)
+	err = rlsError(fmt.Errorf(`pq: cannot change relation "documents"`))
+	assert.NotErrorIs(t, err, ErrObjectDoesNotExist)
+}
+
+func TestPostgresController_CreateTenantPolicy(t *testing.T) {
+	testDB := testDB()
+	testUser := testUser()
+	testPassword := testPassword()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateUser(testUser, testPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	db, err := c.openDB(testDB)
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`
+		CREATE TABLE orders (id int, tenant_id int);
+		CREATE TABLE notes (id int);
+		INSERT INTO orders VALUES (1, 1), (2, 1), (3, 2);
+	`)
+	assert.NoError(t, err)
+
+	err = c.CreateTenantPolicy(testDB, "notes", nil)
+	assert.ErrorIs(t, err, ErrColumnDoesNotExist)
+	err = c.CreateTenantPolicy(testDB, "invoices", nil)
+	assert.ErrorIs(t, err, ErrObjectDoesNotExist)
+
+	err = c.CreateTenantPolicy(testDB, "orders", []string{testUser})
+	assert.NoError(t, err)
+	err = c.CreateTenantPolicy(testDB, "orders", []string{testUser})
+	assert.ErrorIs(t, err, ErrPolicyExists)
+
+	err = c.GrantPrivileges(PrivilegeGrant{
+		Grantee:    testUser,
+		Privileges: []Privilege{PrivilegeSelect, PrivilegeInsert},
+		Target:     Target{Type: ObjectTypeTable, Database: testDB, Name: "orders"},
+	})
+	assert.NoError(t, err)
+
+	userDB, err := sql.Open("postgres", fmt.Sprintf("postgres://%s:%s@localhost:55432/%s?sslmode=disable", testUser, testPassword, testDB))
+	assert.NoError(t, err)
+	defer userDB.Close()
+	userDB.SetMaxOpenConns(1)
+
+	count := func() int {
+		var n int
+		assert.NoError(t, userDB.QueryRow(`SELECT count(*) FROM orders`).Scan(&n))
+		return n
+	}
+	assert.Equal(t, 0, count())
+
+	_, err = userDB.Exec(`SET app.tenant_id = '1'`)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count())
+
+	_, err = userDB.Exec(`INSERT INTO orders VALUES (4, 2)`)
+	assert.Error(t, err)
+
+	_, err = userDB.Exec(`RESET app.tenant_id`)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count())
+
+	policies, err := c.ListPolicies(testDB, "orders")
+	assert.NoError(t, err)
+	if assert.Len(t, policies, 1) {
+		assert.Equal(t, TenantPolicyName, policies[0].Name)
+		assert.Equal(t, PolicyCommandAll, policies[0].Command)
+		assert.Equal(t, []string{testUser}, policies[0].Roles)
+		assert.True(t, policies[0].Permissive)
+		assert.Contains(t, policies[0].Using, "app.tenant_id")
+	}
+
+	err = c.CreatePolicy(testDB, "orders", PolicySpec{Name: "read_all", Command: PolicyCommandSelect, Using: "true"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count())
+
+	err = c.DropPolicy(testDB, "orders", "read_all")
+	assert.NoError(t, err)
+	err = c.DropPolicy(testDB, "orders", "read_all")
+	assert.ErrorIs(t, err, ErrPolicyDoesNotExist)
+
+	err = c.DisableRLS(testDB, "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count())
+}
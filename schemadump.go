@@ -0,0 +1,370 @@
+// postgresctl/schemadump.go
+package postgresctl
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// queryer is implemented by *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// schemaDump is a database schema reconstructed from the catalogs. PreData
+// creates everything needed to load table data, PostData adds constraints,
+// indexes and sequence positions once the data is in.
+//
+// Covered are schemas, extensions, enums, domains, sequences, functions,
+// procedures, tables (including partitioning, identity and generated
+// columns), views, materialized views, constraints and indexes. Ownership,
+// privileges, comments, triggers, rules and policies are not dumped.
+// Functions are created before tables, so functions whose signature refers
+// to a table row type cannot be restored.
+type schemaDump struct {
+	PreData  []string
+	PostData []string
+	Tables   []dumpTable
+}
+
+// dumpTable is a table holding data, Columns excludes generated columns
+type dumpTable struct {
+	Schema  string
+	Name    string
+	Columns []string
+}
+
+// Restricts a query on n (pg_namespace) to user schemas matching $1
+const dumpSchemaFilter = `
+	n.nspname NOT LIKE 'pg\_%'
+	AND n.nspname <> 'information_schema'
+	AND (COALESCE(cardinality($1::text[]), 0) = 0 OR n.nspname = ANY($1))
+`
+
+func notExtensionMember(catalog, oid string) string {
+	return fmt.Sprintf(`NOT EXISTS (
+		SELECT 1 FROM pg_depend dep
+		WHERE dep.classid = '%s'::regclass AND dep.objid = %s AND dep.deptype = 'e'
+	)`, catalog, oid)
+}
+
+var dumpPreDataQueries = []string{
+	// schemas
+	`SELECT format('CREATE SCHEMA IF NOT EXISTS %I;', n.nspname)
+	FROM pg_namespace n
+	WHERE ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_namespace", "n.oid") + `
+	ORDER BY n.nspname`,
+
+	// extensions
+	`SELECT format('CREATE EXTENSION IF NOT EXISTS %I WITH SCHEMA %I;', e.extname, n.nspname)
+	FROM pg_extension e
+	JOIN pg_namespace n ON n.oid = e.extnamespace
+	WHERE e.extname <> 'plpgsql'
+	AND ` + dumpSchemaFilter + `
+	ORDER BY e.extname`,
+
+	// enums
+	`SELECT format('CREATE TYPE %I.%I AS ENUM (%s);', n.nspname, t.typname,
+		(SELECT string_agg(quote_literal(e.enumlabel), ', ' ORDER BY e.enumsortorder)
+		FROM pg_enum e WHERE e.enumtypid = t.oid))
+	FROM pg_type t
+	JOIN pg_namespace n ON n.oid = t.typnamespace
+	WHERE t.typtype = 'e'
+	AND ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_type", "t.oid") + `
+	ORDER BY t.oid`,
+
+	// domains
+	`SELECT format('CREATE DOMAIN %I.%I AS %s%s%s%s;', n.nspname, t.typname,
+		pg_catalog.format_type(t.typbasetype, t.typtypmod),
+		CASE WHEN t.typdefault IS NOT NULL THEN ' DEFAULT ' || t.typdefault ELSE '' END,
+		CASE WHEN t.typnotnull THEN ' NOT NULL' ELSE '' END,
+		COALESCE((SELECT string_agg(format(' CONSTRAINT %I %s', con.conname, pg_catalog.pg_get_constraintdef(con.oid)), '' ORDER BY con.conname)
+		FROM pg_constraint con WHERE con.contypid = t.oid AND con.contype = 'c'), ''))
+	FROM pg_type t
+	JOIN pg_namespace n ON n.oid = t.typnamespace
+	WHERE t.typtype = 'd'
+	AND ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_type", "t.oid") + `
+	ORDER BY t.oid`,
+
+	// sequences, except those backing identity columns
+	`SELECT format('CREATE SEQUENCE %I.%I AS %s INCREMENT BY %s MINVALUE %s MAXVALUE %s START WITH %s CACHE %s%s;',
+		n.nspname, c.relname, pg_catalog.format_type(s.seqtypid, NULL),
+		s.seqincrement, s.seqmin, s.seqmax, s.seqstart, s.seqcache,
+		CASE WHEN s.seqcycle THEN ' CYCLE' ELSE '' END)
+	FROM pg_sequence s
+	JOIN pg_class c ON c.oid = s.seqrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE ` + dumpSchemaFilter + `
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_depend dep
+		WHERE dep.classid = 'pg_class'::regclass AND dep.objid = c.oid AND dep.deptype IN ('i', 'e')
+	)
+	ORDER BY c.oid`,
+
+	// functions and procedures
+	`SELECT pg_catalog.pg_get_functiondef(p.oid) || ';'
+	FROM pg_proc p
+	JOIN pg_namespace n ON n.oid = p.pronamespace
+	WHERE p.prokind IN ('f', 'p')
+	AND ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_proc", "p.oid") + `
+	ORDER BY p.oid`,
+}
+
+var dumpTablesQuery = `
+	SELECT c.oid, n.nspname, c.relname, c.relkind::text, c.relispartition,
+		COALESCE(pg_catalog.pg_get_partkeydef(c.oid), ''),
+		COALESCE((SELECT format('%I.%I', pn.nspname, pc.relname)
+			FROM pg_inherits i
+			JOIN pg_class pc ON pc.oid = i.inhparent
+			JOIN pg_namespace pn ON pn.oid = pc.relnamespace
+			WHERE i.inhrelid = c.oid AND c.relispartition), ''),
+		COALESCE(pg_catalog.pg_get_expr(c.relpartbound, c.oid), '')
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('r', 'p')
+	AND ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+	ORDER BY c.relispartition, c.oid
+`
+
+const dumpColumnsQuery = `
+	SELECT format('%I %s%s%s%s%s', a.attname, pg_catalog.format_type(a.atttypid, a.atttypmod),
+			-- Like pg_dump, only a collation other than the type's own is spelled out
+			CASE WHEN a.attcollation <> 0 AND a.attcollation <> t.typcollation
+				THEN format(' COLLATE %I.%I', cn.nspname, co.collname)
+				ELSE '' END,
+			CASE WHEN a.attgenerated = 's' THEN format(' GENERATED ALWAYS AS (%s) STORED', pg_catalog.pg_get_expr(d.adbin, d.adrelid))
+				WHEN a.atthasdef THEN ' DEFAULT ' || pg_catalog.pg_get_expr(d.adbin, d.adrelid)
+				ELSE '' END,
+			CASE a.attidentity WHEN 'a' THEN ' GENERATED ALWAYS AS IDENTITY'
+				WHEN 'd' THEN ' GENERATED BY DEFAULT AS IDENTITY'
+				ELSE '' END,
+			CASE WHEN a.attnotnull AND a.attidentity = '' THEN ' NOT NULL' ELSE '' END),
+		a.attname,
+		a.attgenerated <> ''
+	FROM pg_attribute a
+	JOIN pg_type t ON t.oid = a.atttypid
+	LEFT JOIN pg_collation co ON co.oid = a.attcollation
+	LEFT JOIN pg_namespace cn ON cn.oid = co.collnamespace
+	LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+	WHERE a.attrelid = $1
+	AND a.attnum > 0
+	AND NOT a.attisdropped
+	ORDER BY a.attnum
+`
+
+var dumpAfterTablesQueries = []string{
+	// serial sequences
+	`SELECT format('ALTER SEQUENCE %I.%I OWNED BY %I.%I.%I;', n.nspname, s.relname, tn.nspname, t.relname, a.attname)
+	FROM pg_depend dep
+	JOIN pg_class s ON s.oid = dep.objid AND s.relkind = 'S'
+	JOIN pg_namespace n ON n.oid = s.relnamespace
+	JOIN pg_class t ON t.oid = dep.refobjid
+	JOIN pg_namespace tn ON tn.oid = t.relnamespace
+	JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = dep.refobjsubid
+	WHERE dep.classid = 'pg_class'::regclass
+	AND dep.refclassid = 'pg_class'::regclass
+	AND dep.deptype = 'a'
+	AND ` + dumpSchemaFilter + `
+	ORDER BY s.oid`,
+
+	// views and materialized views
+	`SELECT CASE c.relkind
+		WHEN 'v' THEN format('CREATE VIEW %I.%I AS %s', n.nspname, c.relname, pg_catalog.pg_get_viewdef(c.oid))
+		ELSE format('CREATE MATERIALIZED VIEW %I.%I AS %s WITH NO DATA;', n.nspname, c.relname, rtrim(pg_catalog.pg_get_viewdef(c.oid), ';'))
+		END
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('v', 'm')
+	AND ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+	ORDER BY c.oid`,
+}
+
+var dumpPostDataQueries = []string{
+	// primary keys, unique, check and exclusion constraints
+	`SELECT format('ALTER TABLE %I.%I ADD CONSTRAINT %I %s;', n.nspname, c.relname, con.conname, pg_catalog.pg_get_constraintdef(con.oid))
+	FROM pg_constraint con
+	JOIN pg_class c ON c.oid = con.conrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE con.contype IN ('p', 'u', 'c', 'x')
+	AND con.conparentid = 0
+	AND con.conislocal
+	AND ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+	ORDER BY CASE con.contype WHEN 'p' THEN 0 ELSE 1 END, con.oid`,
+
+	// indexes not backing a constraint
+	`SELECT pg_catalog.pg_get_indexdef(i.indexrelid) || ';'
+	FROM pg_index i
+	JOIN pg_class ic ON ic.oid = i.indexrelid
+	JOIN pg_class c ON c.oid = i.indrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('r', 'p', 'm')
+	AND NOT ic.relispartition
+	AND NOT EXISTS (
+		SELECT 1 FROM pg_constraint con
+		WHERE con.conindid = i.indexrelid AND con.contype IN ('p', 'u', 'x')
+	)
+	AND ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+	ORDER BY i.indexrelid`,
+
+	// foreign keys
+	`SELECT format('ALTER TABLE %I.%I ADD CONSTRAINT %I %s;', n.nspname, c.relname, con.conname, pg_catalog.pg_get_constraintdef(con.oid))
+	FROM pg_constraint con
+	JOIN pg_class c ON c.oid = con.conrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE con.contype = 'f'
+	AND con.conparentid = 0
+	AND ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+	ORDER BY con.oid`,
+
+	// sequence positions
+	`SELECT format('SELECT pg_catalog.setval(%L, %s, true);', format('%I.%I', n.nspname, s.sequencename), s.last_value)
+	FROM pg_sequences s
+	JOIN pg_namespace n ON n.nspname = s.schemaname
+	WHERE s.last_value IS NOT NULL
+	AND ` + dumpSchemaFilter + `
+	ORDER BY 1`,
+
+	// materialized view contents
+	`SELECT format('REFRESH MATERIALIZED VIEW %I.%I;', n.nspname, c.relname)
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind = 'm'
+	AND ` + dumpSchemaFilter + ` AND ` + notExtensionMember("pg_class", "c.oid") + `
+	ORDER BY c.oid`,
+}
+
+// dumpSchema reconstructs the schema of the database q is connected to,
+// limited to the given schemas if any.
+func dumpSchema(q queryer, schemas []string) (*schemaDump, error) {
+	dump := &schemaDump{PreData: []string{"SET check_function_bodies = false;"}}
+	filter := pq.Array(schemas)
+
+	for _, query := range dumpPreDataQueries {
+		stmts, err := queryStrings(q, query, filter)
+		if err != nil {
+			return nil, fmt.Errorf("error dumping schema: %w", err)
+		}
+		dump.PreData = append(dump.PreData, stmts...)
+	}
+
+	if err := dumpTables(q, filter, dump); err != nil {
+		return nil, err
+	}
+
+	for _, query := range dumpAfterTablesQueries {
+		stmts, err := queryStrings(q, query, filter)
+		if err != nil {
+			return nil, fmt.Errorf("error dumping schema: %w", err)
+		}
+		dump.PreData = append(dump.PreData, stmts...)
+	}
+
+	for _, query := range dumpPostDataQueries {
+		stmts, err := queryStrings(q, query, filter)
+		if err != nil {
+			return nil, fmt.Errorf("error dumping schema: %w", err)
+		}
+		dump.PostData = append(dump.PostData, stmts...)
+	}
+
+	return dump, nil
+}
+
+func dumpTables(q queryer, filter any, dump *schemaDump) error {
+	type table struct {
+		oid                              int64
+		schema, name, kind               string
+		isPartition                      bool
+		partKey, parent, partitionBounds string
+	}
+
+	rows, err := q.Query(dumpTablesQuery, filter)
+	if err != nil {
+		return fmt.Errorf("error listing tables: %w", err)
+	}
+
+	var tables []table
+	for rows.Next() {
+		var t table
+		err := rows.Scan(&t.oid, &t.schema, &t.name, &t.kind, &t.isPartition, &t.partKey, &t.parent, &t.partitionBounds)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning table: %w", err)
+		}
+		tables = append(tables, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		defs, columns, err := dumpColumns(q, t.oid)
+		if err != nil {
+			return fmt.Errorf("error dumping columns of %s.%s: %w", t.schema, t.name, err)
+		}
+
+		stmt := "CREATE TABLE " + quoteIdent(t.schema) + "." + quoteIdent(t.name)
+		if t.isPartition {
+			stmt += " PARTITION OF " + t.parent + " " + t.partitionBounds
+		} else {
+			stmt += " (\n    " + strings.Join(defs, ",\n    ") + "\n)"
+		}
+		if t.kind == "p" {
+			stmt += " PARTITION BY " + t.partKey
+		}
+		dump.PreData = append(dump.PreData, stmt+";")
+
+		// Partitioned tables hold no data themselves
+		if t.kind == "r" {
+			dump.Tables = append(dump.Tables, dumpTable{Schema: t.schema, Name: t.name, Columns: columns})
+		}
+	}
+
+	return nil
+}
+
+func dumpColumns(q queryer, tableOID int64) ([]string, []string, error) {
+	rows, err := q.Query(dumpColumnsQuery, tableOID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var defs, columns []string
+	for rows.Next() {
+		var def, name string
+		var generated bool
+		if err := rows.Scan(&def, &name, &generated); err != nil {
+			return nil, nil, err
+		}
+		defs = append(defs, def)
+		if !generated {
+			columns = append(columns, name)
+		}
+	}
+
+	return defs, columns, rows.Err()
+}
+
+func queryStrings(q queryer, query string, args ...any) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+
+	return result, rows.Err()
+}
@@ -0,0 +1,160 @@
+// postgresctl/server.go
+package postgresctl
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+type ServerRole string
+
+const (
+	ServerRolePrimary ServerRole = "primary"
+	ServerRoleStandby ServerRole = "standby"
+)
+
+var (
+	// ErrServerIsStandby is returned by mutating calls on a hot standby
+	ErrServerIsStandby = fmt.Errorf("server is a standby, writes must go to the primary")
+	ErrNoPrimary       = fmt.Errorf("no primary server found")
+)
+
+// ReplicationStatus describes the server's place in physical replication.
+// Standby fields are empty on a primary and Standbys is empty on a standby.
+type ReplicationStatus struct {
+	Role ServerRole
+
+	// Upstream server of a standby, empty when the WAL receiver isn't running
+	SenderHost     string
+	SenderPort     int
+	ReceiverStatus string
+	ReceiveLSN     string
+	ReplayLSN      string
+	// Time since the last replayed transaction was committed on the primary
+	ReplayDelay time.Duration
+
+	// Standbys and subscriptions streaming from a primary
+	Standbys []ReplicationSender
+}
+
+func (c *PostgresController) ServerRole() (ServerRole, error) {
+	return serverRole(c.db)
+}
+
+func serverRole(db *sql.DB) (ServerRole, error) {
+	var inRecovery bool
+	if err := db.QueryRow(`SELECT pg_catalog.pg_is_in_recovery()`).Scan(&inRecovery); err != nil {
+		return "", fmt.Errorf("error checking server role: %w", err)
+	}
+	if inRecovery {
+		return ServerRoleStandby, nil
+	}
+	return ServerRolePrimary, nil
+}
+
+func (c *PostgresController) ReplicationStatus() (ReplicationStatus, error) {
+	role, err := c.ServerRole()
+	if err != nil {
+		return ReplicationStatus{}, err
+	}
+	status := ReplicationStatus{Role: role}
+
+	if role == ServerRolePrimary {
+		report, err := c.ReplicationLag()
+		if err != nil {
+			return status, err
+		}
+		status.Standbys = report.Senders
+		return status, nil
+	}
+
+	var delay sql.NullFloat64
+	err = c.db.QueryRow(`
+		SELECT COALESCE(pg_catalog.pg_last_wal_receive_lsn()::text, ''),
+			COALESCE(pg_catalog.pg_last_wal_replay_lsn()::text, ''),
+			EXTRACT(EPOCH FROM now() - pg_catalog.pg_last_xact_replay_timestamp())
+	`).Scan(&status.ReceiveLSN, &status.ReplayLSN, &delay)
+	if err != nil {
+		return status, fmt.Errorf("error getting replay position: %w", err)
+	}
+	status.ReplayDelay = time.Duration(delay.Float64 * float64(time.Second))
+
+	err = c.db.QueryRow(`
+		SELECT status, COALESCE(sender_host, ''), COALESCE(sender_port, 0)
+		FROM pg_stat_wal_receiver
+	`).Scan(&status.ReceiverStatus, &status.SenderHost, &status.SenderPort)
+	if err != nil && err != sql.ErrNoRows {
+		return status, fmt.Errorf("error getting WAL receiver status: %w", err)
+	}
+
+	return status, nil
+}
+
+// ensurePrimary refuses writes on a standby up front, they would otherwise
+// fail with "cannot execute ... in a read-only transaction".
+func (c *PostgresController) ensurePrimary() error {
+	role, err := c.ServerRole()
+	if err != nil {
+		return err
+	}
+	if role != ServerRolePrimary {
+		return ErrServerIsStandby
+	}
+	return nil
+}
+
+// connectPrimary tries Host and then every entry of Hosts and returns the
+// connection to the first primary.
+func connectPrimary(conn PostgresConn) (PostgresConn, *sql.DB, error) {
+	candidates := []PostgresConn{}
+	if conn.Host != "" {
+		candidates = append(candidates, conn)
+	}
+	for _, hostPort := range conn.Hosts {
+		candidate := conn
+		host, port, err := splitHostPort(hostPort, conn.Port)
+		if err != nil {
+			return PostgresConn{}, nil, err
+		}
+		candidate.Host, candidate.Port = host, port
+		candidates = append(candidates, candidate)
+	}
+
+	var errs []error
+	for _, candidate := range candidates {
+		db, err := sql.Open("postgres", candidate.connStr())
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		role, err := serverRole(db)
+		if err == nil && role == ServerRolePrimary {
+			return candidate, db, nil
+		}
+		db.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", candidate.Host, candidate.Port, err))
+		}
+	}
+
+	return PostgresConn{}, nil, errors.Join(append([]error{ErrNoPrimary}, errs...)...)
+}
+
+// splitHostPort accepts "host" or "host:port", defaultPort is used for the former
+func splitHostPort(hostPort string, defaultPort int) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		// No port
+		return hostPort, defaultPort, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port in host %q", hostPort)
+	}
+	return host, port, nil
+}
@@ -0,0 +1,64 @@
+// postgresctl/server_test.go
+package postgresctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitHostPort(t *testing.T) {
+	host, port, err := splitHostPort("db1.internal", 5432)
+	assert.NoError(t, err)
+	assert.Equal(t, "db1.internal", host)
+	assert.Equal(t, 5432, port)
+
+	host, port, err = splitHostPort("db2.internal:6432", 5432)
+	assert.NoError(t, err)
+	assert.Equal(t, "db2.internal", host)
+	assert.Equal(t, 6432, port)
+
+	host, port, err = splitHostPort("[::1]:6432", 5432)
+	assert.NoError(t, err)
+	assert.Equal(t, "::1", host)
+	assert.Equal(t, 6432, port)
+
+	_, _, err = splitHostPort("db3.internal:port", 5432)
+	assert.Error(t, err)
+}
+
+func TestPostgresController_ServerRole(t *testing.T) {
+	c := createTestController()
+	defer c.Close()
+
+	role, err := c.ServerRole()
+	assert.NoError(t, err)
+	assert.Equal(t, ServerRolePrimary, role)
+
+	status, err := c.ReplicationStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, ServerRolePrimary, status.Role)
+	assert.Empty(t, status.ReplayLSN)
+
+	assert.NoError(t, c.ensurePrimary())
+}
+
+func TestNewPostgresController_Hosts(t *testing.T) {
+	conn := pc
+	conn.Port = 1
+	conn.Hosts = []string{"localhost:2", conn.Host + ":55432"}
+
+	c, err := NewPostgresController(conn)
+	assert.NoError(t, err)
+	if err == nil {
+		assert.Equal(t, 55432, c.pc.Port)
+		exists, err := c.DatabaseExists("tenant")
+		assert.NoError(t, err)
+		assert.False(t, exists)
+		c.Close()
+	}
+
+	conn.Hosts = []string{"localhost:2"}
+	_, err = NewPostgresController(conn)
+	assert.ErrorIs(t, err, ErrNoPrimary)
+}
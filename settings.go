@@ -0,0 +1,437 @@
+// postgresctl/settings.go
+package postgresctl
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type SettingsController interface {
+	SetDatabaseSetting(dbName, name, value string) error
+	ResetDatabaseSetting(dbName, name string) error
+	GetDatabaseSettings(dbName string) (map[string]string, error)
+	SetRoleSetting(username, dbName, name, value string) error
+	ResetRoleSetting(username, dbName, name string) error
+	GetRoleSettings(username string) ([]RoleSetting, error)
+}
+
+var _ SettingsController = &PostgresController{}
+
+var (
+	ErrUnknownSetting = fmt.Errorf("unknown setting")
+	ErrInvalidSetting = fmt.Errorf("invalid setting value")
+)
+
+// RoleSetting is a per-role default. Database is empty when the setting
+// applies in every database.
+type RoleSetting struct {
+	Database string
+	Name     string
+	Value    string
+}
+
+// Settings that take a comma separated list, each element is quoted separately
+var listSettings = []string{"search_path", "temp_tablespaces", "local_preload_libraries", "session_preload_libraries"}
+
+var settingNameRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)*$`)
+
+var settingValueRe = regexp.MustCompile(`^\s*([-+]?[0-9]*\.?[0-9]+(?:[eE][-+]?[0-9]+)?)\s*([a-zA-Z]*)\s*$`)
+
+var memoryUnits = map[string]float64{
+	"B":  1,
+	"kB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+
+// time units in microseconds
+var timeUnits = map[string]float64{
+	"us":  1,
+	"ms":  1e3,
+	"s":   1e6,
+	"min": 60e6,
+	"h":   3600e6,
+	"d":   86400e6,
+}
+
+var boolValues = []string{"on", "off", "true", "false", "yes", "no", "1", "0"}
+
+type settingDef struct {
+	name     string
+	vartype  string
+	context  string
+	unit     string
+	min      sql.NullFloat64
+	max      sql.NullFloat64
+	enumvals []string
+}
+
+func (c *PostgresController) SetDatabaseSetting(dbName, name, value string) error {
+	if err := validateDBName(dbName); err != nil {
+		return err
+	}
+	if err := c.validateSetting(name, value); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	_, err := c.db.Exec(`ALTER DATABASE "` + dbName + `" SET ` + name + ` = ` + settingValueSQL(name, value))
+	if err != nil {
+		if mapped := databaseSettingError(err); mapped != nil {
+			return mapped
+		}
+		return fmt.Errorf("error setting %s: %w", name, err)
+	}
+	return nil
+}
+
+func (c *PostgresController) ResetDatabaseSetting(dbName, name string) error {
+	if err := validateDBName(dbName); err != nil {
+		return err
+	}
+	if err := validateSettingName(name); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	_, err := c.db.Exec(`ALTER DATABASE "` + dbName + `" RESET ` + name)
+	if err != nil {
+		if mapped := databaseSettingError(err); mapped != nil {
+			return mapped
+		}
+		return fmt.Errorf("error resetting %s: %w", name, err)
+	}
+	return nil
+}
+
+func (c *PostgresController) GetDatabaseSettings(dbName string) (map[string]string, error) {
+	if err := validateDBName(dbName); err != nil {
+		return nil, err
+	}
+
+	if exists, err := c.DatabaseExists(dbName); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, ErrDBDoesNotExist
+	}
+
+	rows, err := c.db.Query(`
+		SELECT unnest(s.setconfig)
+		FROM pg_db_role_setting s
+		JOIN pg_database d ON d.oid = s.setdatabase
+		WHERE d.datname = $1
+		AND s.setrole = 0
+	`, dbName)
+	if err != nil {
+		return nil, fmt.Errorf("error getting database settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := map[string]string{}
+	for rows.Next() {
+		var entry string
+		if err := rows.Scan(&entry); err != nil {
+			return nil, fmt.Errorf("error scanning database setting: %w", err)
+		}
+		name, value, _ := strings.Cut(entry, "=")
+		settings[name] = value
+	}
+
+	return settings, rows.Err()
+}
+
+// SetRoleSetting sets a default for username, only in dbName if it is not empty.
+func (c *PostgresController) SetRoleSetting(username, dbName, name, value string) error {
+	target, err := roleSettingTarget(username, dbName)
+	if err != nil {
+		return err
+	}
+	if err := c.validateSetting(name, value); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	_, err = c.db.Exec(target + ` SET ` + name + ` = ` + settingValueSQL(name, value))
+	if err != nil {
+		if mapped := roleSettingError(err); mapped != nil {
+			return mapped
+		}
+		return fmt.Errorf("error setting %s: %w", name, err)
+	}
+	return nil
+}
+
+func (c *PostgresController) ResetRoleSetting(username, dbName, name string) error {
+	target, err := roleSettingTarget(username, dbName)
+	if err != nil {
+		return err
+	}
+	if err := validateSettingName(name); err != nil {
+		return err
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	_, err = c.db.Exec(target + ` RESET ` + name)
+	if err != nil {
+		if mapped := roleSettingError(err); mapped != nil {
+			return mapped
+		}
+		return fmt.Errorf("error resetting %s: %w", name, err)
+	}
+	return nil
+}
+
+func (c *PostgresController) GetRoleSettings(username string) ([]RoleSetting, error) {
+	if err := validateUsername(username); err != nil {
+		return nil, err
+	}
+
+	if exists, err := c.UserExists(username); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, ErrUserDoesNotExist
+	}
+
+	rows, err := c.db.Query(`
+		SELECT COALESCE(d.datname, ''), unnest(s.setconfig)
+		FROM pg_db_role_setting s
+		JOIN pg_roles r ON r.oid = s.setrole
+		LEFT JOIN pg_database d ON d.oid = s.setdatabase
+		WHERE r.rolname = $1
+		ORDER BY 1
+	`, username)
+	if err != nil {
+		return nil, fmt.Errorf("error getting role settings: %w", err)
+	}
+	defer rows.Close()
+
+	var settings []RoleSetting
+	for rows.Next() {
+		var setting RoleSetting
+		var entry string
+		if err := rows.Scan(&setting.Database, &entry); err != nil {
+			return nil, fmt.Errorf("error scanning role setting: %w", err)
+		}
+		setting.Name, setting.Value, _ = strings.Cut(entry, "=")
+		settings = append(settings, setting)
+	}
+
+	return settings, rows.Err()
+}
+
+func roleSettingTarget(username, dbName string) (string, error) {
+	if err := validateUsername(username); err != nil {
+		return "", err
+	}
+
+	target := `ALTER ROLE "` + username + `"`
+	if dbName != "" {
+		if err := validateDBName(dbName); err != nil {
+			return "", err
+		}
+		target += ` IN DATABASE "` + dbName + `"`
+	}
+	return target, nil
+}
+
+// databaseSettingError maps a missing database to ErrDBDoesNotExist, it
+// returns nil for other errors. Only the SQLSTATE is checked, a setting
+// value may name other missing objects, e.g. a tablespace.
+func databaseSettingError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "3D000" {
+		return ErrDBDoesNotExist
+	}
+	return nil
+}
+
+// roleSettingError maps a missing role or database to its error, it
+// returns nil for other errors
+func roleSettingError(err error) error {
+	msg := strings.TrimPrefix(err.Error(), "pq: ")
+	if !strings.HasSuffix(msg, "does not exist") {
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(msg, "database "):
+		return ErrDBDoesNotExist
+	case strings.HasPrefix(msg, "role "):
+		return ErrUserDoesNotExist
+	}
+	return nil
+}
+
+// validateSetting checks name and value against pg_settings. Custom
+// settings (names with a dot, e.g. app.tenant_id) are not known to the
+// server in advance and accept any value.
+func (c *PostgresController) validateSetting(name, value string) error {
+	if err := validateSettingName(name); err != nil {
+		return err
+	}
+	if strings.Contains(name, ".") {
+		return nil
+	}
+
+	def, err := c.settingDef(name)
+	if err != nil {
+		return err
+	}
+	return def.validate(value)
+}
+
+func (c *PostgresController) settingDef(name string) (settingDef, error) {
+	def := settingDef{name: name}
+	var unit, minVal, maxVal sql.NullString
+	err := c.db.QueryRow(`
+		SELECT vartype, context, unit, min_val, max_val, COALESCE(enumvals, '{}')
+		FROM pg_settings
+		WHERE name = $1
+	`, name).Scan(&def.vartype, &def.context, &unit, &minVal, &maxVal, pq.Array(&def.enumvals))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return settingDef{}, fmt.Errorf("%w: %s", ErrUnknownSetting, name)
+		}
+		return settingDef{}, fmt.Errorf("error looking up setting %s: %w", name, err)
+	}
+
+	def.unit = unit.String
+	if minVal.Valid {
+		if v, err := strconv.ParseFloat(minVal.String, 64); err == nil {
+			def.min = sql.NullFloat64{Float64: v, Valid: true}
+		}
+	}
+	if maxVal.Valid {
+		if v, err := strconv.ParseFloat(maxVal.String, 64); err == nil {
+			def.max = sql.NullFloat64{Float64: v, Valid: true}
+		}
+	}
+
+	return def, nil
+}
+
+func (def settingDef) validate(value string) error {
+	// Only these contexts can be changed per database or role
+	if def.context != "user" && def.context != "superuser" {
+		return fmt.Errorf("%w: %s cannot be set per database or role (context %s)", ErrInvalidSetting, def.name, def.context)
+	}
+
+	switch def.vartype {
+	case "bool":
+		if !contains(boolValues, strings.ToLower(value)) {
+			return fmt.Errorf("%w: %s requires a boolean, got %q", ErrInvalidSetting, def.name, value)
+		}
+	case "enum":
+		for _, v := range def.enumvals {
+			if strings.EqualFold(v, value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s must be one of %s, got %q", ErrInvalidSetting, def.name, strings.Join(def.enumvals, ", "), value)
+	case "integer", "real":
+		n, err := parseSettingNumber(value, def.unit)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrInvalidSetting, def.name, err)
+		}
+		if def.vartype == "integer" && def.unit == "" && n != float64(int64(n)) {
+			return fmt.Errorf("%w: %s requires an integer, got %q", ErrInvalidSetting, def.name, value)
+		}
+		if (def.min.Valid && n < def.min.Float64) || (def.max.Valid && n > def.max.Float64) {
+			return fmt.Errorf("%w: %s must be between %v and %v, got %q", ErrInvalidSetting, def.name, def.min.Float64, def.max.Float64, value)
+		}
+	}
+
+	return nil
+}
+
+// parseSettingNumber parses a value such as "30s" or "64MB" and converts
+// it into settingUnit, the unit reported by pg_settings (e.g. "ms", "8kB").
+func parseSettingNumber(value, settingUnit string) (float64, error) {
+	m := settingValueRe.FindStringSubmatch(value)
+	if m == nil {
+		return 0, fmt.Errorf("%q is not a number", value)
+	}
+
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", value)
+	}
+
+	valueUnit := m[2]
+	if valueUnit == "" {
+		return n, nil
+	}
+	if settingUnit == "" {
+		return 0, fmt.Errorf("%q has a unit but the setting is unitless", value)
+	}
+
+	// pg_settings units may carry a multiplier, e.g. "8kB"
+	multiplier := 1.0
+	baseUnit := strings.TrimLeft(settingUnit, "0123456789")
+	if prefix := strings.TrimSuffix(settingUnit, baseUnit); prefix != "" {
+		multiplier, _ = strconv.ParseFloat(prefix, 64)
+	}
+
+	for _, units := range []map[string]float64{memoryUnits, timeUnits} {
+		base, ok := units[baseUnit]
+		if !ok {
+			continue
+		}
+		factor, ok := units[valueUnit]
+		if !ok {
+			return 0, fmt.Errorf("invalid unit %q, expected a unit compatible with %s", valueUnit, settingUnit)
+		}
+		return n * factor / (base * multiplier), nil
+	}
+
+	return 0, fmt.Errorf("unsupported setting unit %q", settingUnit)
+}
+
+// settingEnabled reports whether a stored boolean setting value is on
+func settingEnabled(value string) bool {
+	switch strings.ToLower(value) {
+	case "on", "true", "yes", "1":
+		return true
+	}
+	return false
+}
+
+func validateSettingName(name string) error {
+	if name == "" {
+		return fmt.Errorf("setting name cannot be empty")
+	}
+	if !settingNameRe.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrUnknownSetting, name)
+	}
+	return nil
+}
+
+func settingValueSQL(name, value string) string {
+	if !contains(listSettings, name) {
+		return quoteLiteral(value)
+	}
+
+	var elems []string
+	for _, elem := range strings.Split(value, ",") {
+		elems = append(elems, quoteLiteral(strings.TrimSpace(elem)))
+	}
+	return strings.Join(elems, ", ")
+}
@@ -0,0 +1,173 @@
+// postgresctl/settings_test.go
+package postgresctl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSettingNumber(t *testing.T) {
+	tests := []struct {
+		value string
+		unit  string
+		want  float64
+	}{
+		{"100", "", 100},
+		{"30s", "ms", 30000},
+		{"1min", "s", 60},
+		{"500 ms", "ms", 500},
+		{"64MB", "kB", 65536},
+		{"1GB", "8kB", 131072},
+		{"2.5", "", 2.5},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSettingNumber(tt.value, tt.unit)
+		assert.NoError(t, err, tt.value)
+		assert.Equal(t, tt.want, got, tt.value)
+	}
+
+	_, err := parseSettingNumber("fast", "ms")
+	assert.Error(t, err)
+
+	_, err = parseSettingNumber("10MB", "ms")
+	assert.Error(t, err)
+
+	_, err = parseSettingNumber("10s", "")
+	assert.Error(t, err)
+}
+
+func TestSettingValueSQL(t *testing.T) {
+	assert.Equal(t, `'30s'`, settingValueSQL("statement_timeout", "30s"))
+	assert.Equal(t, `'it''s'`, settingValueSQL("application_name", "it's"))
+	assert.Equal(t, `'app', 'public'`, settingValueSQL("search_path", "app, public"))
+}
+
+func TestPostgresController_DatabaseSettings(t *testing.T) {
+	testDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	_, err := c.GetDatabaseSettings(testDB)
+	assert.Equal(t, ErrDBDoesNotExist, err)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	settings, err := c.GetDatabaseSettings(testDB)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(settings))
+
+	err = c.SetDatabaseSetting(testDB, "statement_timeout", "30s")
+	assert.NoError(t, err)
+	err = c.SetDatabaseSetting(testDB, "search_path", "app, public")
+	assert.NoError(t, err)
+	err = c.SetDatabaseSetting(testDB, "work_mem", "64MB")
+	assert.NoError(t, err)
+
+	settings, err = c.GetDatabaseSettings(testDB)
+	assert.NoError(t, err)
+	assert.Equal(t, "30s", settings["statement_timeout"])
+	assert.Equal(t, "app, public", settings["search_path"])
+	assert.Equal(t, "64MB", settings["work_mem"])
+
+	err = c.ResetDatabaseSetting(testDB, "work_mem")
+	assert.NoError(t, err)
+
+	settings, err = c.GetDatabaseSettings(testDB)
+	assert.NoError(t, err)
+	assert.NotContains(t, settings, "work_mem")
+
+	err = c.SetDatabaseSetting(testDB, "no_such_setting", "1")
+	assert.ErrorIs(t, err, ErrUnknownSetting)
+
+	err = c.SetDatabaseSetting(testDB, "statement_timeout", "soon")
+	assert.ErrorIs(t, err, ErrInvalidSetting)
+
+	err = c.SetDatabaseSetting(testDB, "work_mem", "4TB")
+	assert.ErrorIs(t, err, ErrInvalidSetting)
+
+	err = c.SetDatabaseSetting(testDB, "default_transaction_isolation", "sometimes")
+	assert.ErrorIs(t, err, ErrInvalidSetting)
+
+	err = c.SetDatabaseSetting(testDB, "shared_buffers", "1GB")
+	assert.ErrorIs(t, err, ErrInvalidSetting)
+
+	err = c.SetDatabaseSetting(testDB, "statement_timeout; DROP DATABASE x", "1")
+	assert.ErrorIs(t, err, ErrUnknownSetting)
+}
+
+func TestPostgresController_RoleSettings(t *testing.T) {
+	testDB := testDB()
+	testUser := testUser()
+	testPassword := testPassword()
+
+	c := createTestController()
+	defer c.Close()
+
+	_, err := c.GetRoleSettings(testUser)
+	assert.Equal(t, ErrUserDoesNotExist, err)
+
+	err = c.CreateUser(testUser, testPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	err = c.SetRoleSetting(testUser, "", "idle_in_transaction_session_timeout", "1min")
+	assert.NoError(t, err)
+	err = c.SetRoleSetting(testUser, testDB, "statement_timeout", "5s")
+	assert.NoError(t, err)
+	err = c.SetRoleSetting(testUser, testDB, "app.tenant_id", "42")
+	assert.NoError(t, err)
+
+	settings, err := c.GetRoleSettings(testUser)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []RoleSetting{
+		{Database: "", Name: "idle_in_transaction_session_timeout", Value: "1min"},
+		{Database: testDB, Name: "statement_timeout", Value: "5s"},
+		{Database: testDB, Name: "app.tenant_id", Value: "42"},
+	}, settings)
+
+	err = c.ResetRoleSetting(testUser, testDB, "statement_timeout")
+	assert.NoError(t, err)
+
+	settings, err = c.GetRoleSettings(testUser)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(settings))
+
+	err = c.SetRoleSetting(testUser, "", "statement_timeout", "-5")
+	assert.ErrorIs(t, err, ErrInvalidSetting)
+
+	for _, name := range baseUsers {
+		err = c.SetRoleSetting(name, "", "statement_timeout", "5s")
+		assert.Error(t, err)
+	}
+
+	err = c.SetRoleSetting(testUser, "no_such_db", "statement_timeout", "5s")
+	assert.ErrorIs(t, err, ErrDBDoesNotExist)
+	err = c.ResetRoleSetting(testUser, "no_such_db", "statement_timeout")
+	assert.ErrorIs(t, err, ErrDBDoesNotExist)
+	err = c.SetRoleSetting("no_such_user", testDB, "statement_timeout", "5s")
+	assert.ErrorIs(t, err, ErrUserDoesNotExist)
+}
+
+func TestDatabaseSettingError(t *testing.T) {
+	assert.Equal(t, ErrDBDoesNotExist, databaseSettingError(&pq.Error{Code: "3D000", Message: `database "shop" does not exist`}))
+	assert.Equal(t, ErrDBDoesNotExist, databaseSettingError(fmt.Errorf("wrapped: %w", &pq.Error{Code: "3D000"})))
+	assert.Nil(t, databaseSettingError(&pq.Error{Code: "42704", Message: `tablespace "fast" does not exist`}))
+	assert.Nil(t, databaseSettingError(fmt.Errorf(`pq: database "shop" does not exist`)))
+}
+
+func TestRoleSettingError(t *testing.T) {
+	assert.Equal(t, ErrDBDoesNotExist, roleSettingError(fmt.Errorf(`pq: database "shop" does not exist`)))
+	assert.Equal(t, ErrUserDoesNotExist, roleSettingError(fmt.Errorf(`pq: role "app" does not exist`)))
+	assert.Nil(t, roleSettingError(fmt.Errorf(`pq: permission denied to set parameter "log_statement"`)))
+}
@@ -0,0 +1,335 @@
+// postgresctl/sizes.go
+package postgresctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultSizeCollectorInterval = time.Hour
+
+var (
+	ErrNotEnoughSamples = fmt.Errorf("not enough size samples")
+	ErrNoGrowth         = fmt.Errorf("database is not growing")
+)
+
+type SchemaSize struct {
+	Schema string
+	Size   int64
+}
+
+type RelationSize struct {
+	Schema string
+	Name   string
+	Kind   TableKind
+	Size   int64
+}
+
+// SizeBreakdown splits the database size by user schema. Schema sizes include
+// indexes and TOAST; whatever is left of Total is the system catalogs and file
+// overhead.
+type SizeBreakdown struct {
+	Total        int64
+	Schemas      []SchemaSize
+	TopRelations []RelationSize
+}
+
+func (c *PostgresController) SizeBreakdown(dbName string, topN int) (SizeBreakdown, error) {
+	total, err := c.Size(dbName)
+	if err != nil {
+		return SizeBreakdown{}, err
+	}
+
+	db, err := c.openDB(dbName)
+	if err != nil {
+		return SizeBreakdown{}, err
+	}
+	defer db.Close()
+
+	breakdown := SizeBreakdown{Total: total}
+
+	rows, err := db.Query(`
+		SELECT n.nspname, SUM(pg_catalog.pg_total_relation_size(c.oid))::bigint
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'm', 'S')
+		AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		AND n.nspname NOT LIKE 'pg\_toast%'
+		GROUP BY n.nspname
+		ORDER BY 2 DESC, 1
+	`)
+	if err != nil {
+		return SizeBreakdown{}, fmt.Errorf("error getting schema sizes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s SchemaSize
+		if err := rows.Scan(&s.Schema, &s.Size); err != nil {
+			return SizeBreakdown{}, fmt.Errorf("error scanning schema size: %w", err)
+		}
+		breakdown.Schemas = append(breakdown.Schemas, s)
+	}
+	if err := rows.Err(); err != nil {
+		return SizeBreakdown{}, err
+	}
+
+	if topN <= 0 {
+		return breakdown, nil
+	}
+
+	rows, err = db.Query(`
+		SELECT n.nspname, c.relname, c.relkind::text, pg_catalog.pg_total_relation_size(c.oid)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'm', 'S')
+		AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		AND n.nspname NOT LIKE 'pg\_toast%'
+		ORDER BY 4 DESC, 1, 2
+		LIMIT $1
+	`, topN)
+	if err != nil {
+		return SizeBreakdown{}, fmt.Errorf("error getting relation sizes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r RelationSize
+		var code string
+		if err := rows.Scan(&r.Schema, &r.Name, &code, &r.Size); err != nil {
+			return SizeBreakdown{}, fmt.Errorf("error scanning relation size: %w", err)
+		}
+		r.Kind = tableKindFromCode(code)
+		breakdown.TopRelations = append(breakdown.TopRelations, r)
+	}
+
+	return breakdown, rows.Err()
+}
+
+type SizeSample struct {
+	Database string
+	Time     time.Time
+	Size     int64
+}
+
+// SizeStore keeps size samples; Samples returns them in chronological order.
+type SizeStore interface {
+	AddSample(sample SizeSample) error
+	Samples(dbName string) ([]SizeSample, error)
+}
+
+var _ SizeStore = &MemorySizeStore{}
+
+// MemorySizeStore keeps the last maxSamples samples per database in memory.
+type MemorySizeStore struct {
+	mu         sync.Mutex
+	maxSamples int
+	samples    map[string][]SizeSample
+}
+
+func NewMemorySizeStore(maxSamples int) *MemorySizeStore {
+	return &MemorySizeStore{maxSamples: maxSamples, samples: map[string][]SizeSample{}}
+}
+
+func (s *MemorySizeStore) AddSample(sample SizeSample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	samples := append(s.samples[sample.Database], sample)
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+	if s.maxSamples > 0 && len(samples) > s.maxSamples {
+		samples = samples[len(samples)-s.maxSamples:]
+	}
+	s.samples[sample.Database] = samples
+	return nil
+}
+
+func (s *MemorySizeStore) Samples(dbName string) ([]SizeSample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]SizeSample(nil), s.samples[dbName]...), nil
+}
+
+type SizeCollector struct {
+	c         *PostgresController
+	store     SizeStore
+	interval  time.Duration
+	databases []string
+	handler   func(dbName string, err error)
+}
+
+type SizeCollectorOption func(*SizeCollector)
+
+func WithSizeCollectorInterval(interval time.Duration) SizeCollectorOption {
+	return func(sc *SizeCollector) {
+		sc.interval = interval
+	}
+}
+
+// WithSizeCollectorDatabases limits collection to the given databases,
+// by default every database from ListDatabases is sampled.
+func WithSizeCollectorDatabases(databases []string) SizeCollectorOption {
+	return func(sc *SizeCollector) {
+		sc.databases = databases
+	}
+}
+
+// WithSizeCollectorHandler is called for every database that could not be
+// sampled. Failing to list the databases is reported with an empty dbName.
+func WithSizeCollectorHandler(handler func(dbName string, err error)) SizeCollectorOption {
+	return func(sc *SizeCollector) {
+		sc.handler = handler
+	}
+}
+
+func NewSizeCollector(c *PostgresController, store SizeStore, opts ...SizeCollectorOption) (*SizeCollector, error) {
+	if store == nil {
+		return nil, fmt.Errorf("size store cannot be nil")
+	}
+
+	sc := &SizeCollector{c: c, store: store, interval: defaultSizeCollectorInterval}
+
+	for _, opt := range opts {
+		opt(sc)
+	}
+
+	if sc.interval <= 0 {
+		return nil, fmt.Errorf("size collector interval must be positive")
+	}
+
+	return sc, nil
+}
+
+// Run samples sizes every interval until ctx is done.
+func (sc *SizeCollector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(sc.interval)
+	defer ticker.Stop()
+
+	for {
+		// Failures are reported to the handler and retried on the next tick
+		_, _ = sc.Collect()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect takes one sample per database and adds it to the store. A database
+// that fails is reported to the handler and skipped, the errors of all
+// failed databases are returned together.
+func (sc *SizeCollector) Collect() ([]SizeSample, error) {
+	databases := sc.databases
+	if len(databases) == 0 {
+		var err error
+		databases, err = sc.c.ListDatabases()
+		if err != nil {
+			err = fmt.Errorf("error listing databases: %w", err)
+			sc.report("", err)
+			return nil, err
+		}
+	}
+
+	var samples []SizeSample
+	var errs []error
+	for _, dbName := range databases {
+		sample, err := sc.collect(dbName)
+		if err != nil {
+			sc.report(dbName, err)
+			errs = append(errs, err)
+			continue
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, errors.Join(errs...)
+}
+
+func (sc *SizeCollector) collect(dbName string) (SizeSample, error) {
+	size, err := sc.c.Size(dbName)
+	if err != nil {
+		return SizeSample{}, fmt.Errorf("error sampling %s: %w", dbName, err)
+	}
+
+	sample := SizeSample{Database: dbName, Time: time.Now(), Size: size}
+	if err := sc.store.AddSample(sample); err != nil {
+		return SizeSample{}, fmt.Errorf("error storing sample for %s: %w", dbName, err)
+	}
+	return sample, nil
+}
+
+func (sc *SizeCollector) report(dbName string, err error) {
+	if sc.handler != nil {
+		sc.handler(dbName, err)
+	}
+}
+
+// GrowthRate returns the growth of dbName in bytes per second.
+func (sc *SizeCollector) GrowthRate(dbName string) (float64, error) {
+	samples, err := sc.store.Samples(dbName)
+	if err != nil {
+		return 0, err
+	}
+	return growthRate(samples)
+}
+
+// Forecast returns when dbName is expected to reach quota bytes at its
+// current growth rate. ErrNoGrowth is returned if it is not growing.
+func (sc *SizeCollector) Forecast(dbName string, quota int64) (time.Time, error) {
+	samples, err := sc.store.Samples(dbName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return forecastQuota(samples, quota)
+}
+
+// growthRate fits a least-squares line through the samples.
+func growthRate(samples []SizeSample) (float64, error) {
+	if len(samples) < 2 {
+		return 0, ErrNotEnoughSamples
+	}
+
+	origin := samples[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.Time.Sub(origin).Seconds()
+		y := float64(s.Size)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	n := float64(len(samples))
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0, ErrNotEnoughSamples
+	}
+
+	return (n*sumXY - sumX*sumY) / denom, nil
+}
+
+func forecastQuota(samples []SizeSample, quota int64) (time.Time, error) {
+	rate, err := growthRate(samples)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	last := samples[len(samples)-1]
+	if last.Size >= quota {
+		return last.Time, nil
+	}
+	if rate <= 0 {
+		return time.Time{}, ErrNoGrowth
+	}
+
+	seconds := float64(quota-last.Size) / rate
+	return last.Time.Add(time.Duration(seconds * float64(time.Second))), nil
+}
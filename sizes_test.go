@@ -0,0 +1,137 @@
+// postgresctl/sizes_test.go
+package postgresctl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrowthRateAndForecast(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	store := NewMemorySizeStore(3)
+	for i := 0; i < 5; i++ {
+		err := store.AddSample(SizeSample{Database: "db", Time: start.Add(time.Duration(i) * time.Hour), Size: int64(1000 + i*3600)})
+		assert.NoError(t, err)
+	}
+
+	samples, err := store.Samples("db")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(samples))
+	assert.Equal(t, start.Add(2*time.Hour), samples[0].Time)
+
+	// One byte per second
+	rate, err := growthRate(samples)
+	assert.NoError(t, err)
+	assert.InDelta(t, 1.0, rate, 0.0001)
+
+	at, err := forecastQuota(samples, int64(1000+4*3600+60))
+	assert.NoError(t, err)
+	assert.Equal(t, start.Add(4*time.Hour+time.Minute), at)
+
+	// Already over quota
+	at, err = forecastQuota(samples, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, start.Add(4*time.Hour), at)
+
+	_, err = growthRate(samples[:1])
+	assert.ErrorIs(t, err, ErrNotEnoughSamples)
+
+	flat := []SizeSample{{Time: start, Size: 10}, {Time: start.Add(time.Hour), Size: 10}}
+	_, err = forecastQuota(flat, 100)
+	assert.ErrorIs(t, err, ErrNoGrowth)
+}
+
+func TestPostgresController_SizeBreakdown(t *testing.T) {
+	testDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	_, err := c.SizeBreakdown(testDB, 5)
+	assert.Error(t, err)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	db, err := c.openDB(testDB)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE SCHEMA app;
+		CREATE TABLE app.big (id SERIAL PRIMARY KEY, payload TEXT);
+		INSERT INTO app.big (payload) SELECT repeat('x', 200) FROM generate_series(1, 5000);
+	`)
+	assert.NoError(t, err)
+
+	breakdown, err := c.SizeBreakdown(testDB, 1)
+	assert.NoError(t, err)
+	assert.True(t, breakdown.Total > 0)
+	assert.Equal(t, 1, len(breakdown.TopRelations))
+	assert.Equal(t, "app", breakdown.TopRelations[0].Schema)
+	assert.Equal(t, "big", breakdown.TopRelations[0].Name)
+
+	var schemas []string
+	var sum int64
+	for _, s := range breakdown.Schemas {
+		schemas = append(schemas, s.Schema)
+		sum += s.Size
+	}
+	assert.Contains(t, schemas, "app")
+	assert.NotContains(t, schemas, "pg_catalog")
+	assert.NotContains(t, schemas, "information_schema")
+	assert.True(t, sum <= breakdown.Total)
+}
+
+func TestSizeCollector_Collect(t *testing.T) {
+	testDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	store := NewMemorySizeStore(0)
+	sc, err := NewSizeCollector(c, store, WithSizeCollectorDatabases([]string{testDB}))
+	assert.NoError(t, err)
+
+	_, err = sc.GrowthRate(testDB)
+	assert.ErrorIs(t, err, ErrNotEnoughSamples)
+
+	for i := 0; i < 2; i++ {
+		samples, err := sc.Collect()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(samples))
+		assert.True(t, samples[0].Size > 0)
+	}
+
+	samples, err := store.Samples(testDB)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(samples))
+
+	// A missing database doesn't stop the others from being sampled
+	missing := testDB + "_missing"
+	var failed []string
+	sc, err = NewSizeCollector(c, store,
+		WithSizeCollectorDatabases([]string{missing, testDB}),
+		WithSizeCollectorHandler(func(dbName string, err error) {
+			failed = append(failed, dbName)
+		}),
+	)
+	assert.NoError(t, err)
+
+	collected, err := sc.Collect()
+	assert.Error(t, err)
+	assert.Equal(t, []string{missing}, failed)
+	assert.Equal(t, 1, len(collected))
+	assert.Equal(t, testDB, collected[0].Database)
+
+	_, err = NewSizeCollector(c, nil)
+	assert.Error(t, err)
+}
@@ -16,6 +16,12 @@ type UserController interface {
 	CreateUserWithMaxConn(username, password string, maxConn int) error
 	UpdateUserMaxConn(username string, maxConn int) error
 	GetUserMaxConn(username string) (int, error)
+	RenameUser(oldName, newName, newPassword string) error
+	SetUserReadOnly(username string, readOnly, terminateSessions bool) error
+	UserReadOnly(username string) (bool, error)
+	DeleteUserWithOptions(username string, opts DeleteUserOptions) error
+	PreviewUserDependencies(username string) ([]UserDependency, error)
+	DescribeUser(username string) (UserInfo, error)
 }
 
 var _ UserController = &PostgresController{}
@@ -25,6 +31,8 @@ var baseUsers = []string{"postgres"}
 var (
 	ErrUserExists       = fmt.Errorf("user exists")
 	ErrUserDoesNotExist = fmt.Errorf("user does not exist")
+	// ALTER ROLE ... RENAME clears MD5 passwords because the username is part of the hash
+	ErrPasswordRequired = fmt.Errorf("renaming a user with an MD5 password requires a new password")
 )
 
 func (c *PostgresController) CreateUser(username, password string) error {
@@ -38,6 +46,10 @@ func (c *PostgresController) CreateUser(username, password string) error {
 		return err
 	}
 
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
 	_, err = c.db.Exec("CREATE ROLE \"" + username + "\" WITH LOGIN PASSWORD '" + password + "'")
 	if err != nil {
 		if strings.Contains(err.Error(), "already exists") {
@@ -59,6 +71,10 @@ func (c *PostgresController) CreateUserWithMaxConn(username, password string, ma
 		return err
 	}
 
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
 	_, err = c.db.Exec(fmt.Sprintf(
 		"CREATE ROLE \"%s\" WITH LOGIN PASSWORD '%s' CONNECTION LIMIT %d",
 		username, password, maxConn))
@@ -101,6 +117,10 @@ func (c *PostgresController) UpdateUserMaxConn(username string, maxConn int) err
 		return err
 	}
 
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
 	_, err = c.db.Exec(fmt.Sprintf(
 		"ALTER ROLE \"%s\" WITH CONNECTION LIMIT %d",
 		username, maxConn))
@@ -124,6 +144,10 @@ func (c *PostgresController) UpdateUserPassword(username, password string) error
 		return err
 	}
 
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
 	_, err = c.db.Exec(fmt.Sprintf(
 		"ALTER ROLE \"%s\" WITH PASSWORD '%s'",
 		username, password))
@@ -141,12 +165,13 @@ func (c *PostgresController) DeleteUser(username string) error {
 		return err
 	}
 
-	_, err := c.db.Exec(fmt.Sprintf(`
-		SELECT pg_terminate_backend(pid)
-		FROM pg_stat_activity
-		WHERE usename = '%s'`, username))
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	err := c.terminateUserConnections(username)
 	if err != nil {
-		return fmt.Errorf("error terminating user connections: %w", err)
+		return err
 	}
 
 	_, err = c.db.Exec(fmt.Sprintf(`DROP OWNED BY "%s"`, username))
@@ -164,6 +189,200 @@ func (c *PostgresController) DeleteUser(username string) error {
 
 	return nil
 }
+
+// RenameUser renames a role. newPassword may be empty unless the role has an
+// MD5 password, which PostgreSQL clears on rename; ErrPasswordRequired is
+// returned in that case before anything is changed. Without access to
+// pg_authid the password type can't be told, so any password counts as MD5.
+// The rename and the new password are applied in one transaction.
+func (c *PostgresController) RenameUser(oldName, newName, newPassword string) error {
+	if err := validateUsername(oldName); err != nil {
+		return err
+	}
+	if err := validateUsername(newName); err != nil {
+		return err
+	}
+	if newPassword != "" {
+		if err := validatePassword(newPassword); err != nil {
+			return err
+		}
+	}
+
+	if err := c.ensurePrimary(); err != nil {
+		return err
+	}
+
+	var hasPassword, canReadAuthid bool
+	err := c.db.QueryRow(`
+		SELECT rolpassword IS NOT NULL, pg_catalog.has_table_privilege('pg_catalog.pg_authid', 'SELECT')
+		FROM pg_roles
+		WHERE rolname = $1
+	`, oldName).Scan(&hasPassword, &canReadAuthid)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUserDoesNotExist
+		}
+		return fmt.Errorf("error checking user password: %w", err)
+	}
+
+	md5Password := hasPassword
+	if hasPassword && canReadAuthid {
+		err = c.db.QueryRow(`
+			SELECT COALESCE(rolpassword LIKE 'md5%', false)
+			FROM pg_authid
+			WHERE rolname = $1
+		`, oldName).Scan(&md5Password)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrUserDoesNotExist
+			}
+			return fmt.Errorf("error checking user password: %w", err)
+		}
+	}
+	if md5Password && newPassword == "" {
+		return ErrPasswordRequired
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(fmt.Sprintf(`ALTER ROLE "%s" RENAME TO "%s"`, oldName, newName))
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return ErrUserExists
+		}
+		if strings.Contains(err.Error(), "does not exist") {
+			return ErrUserDoesNotExist
+		}
+		return fmt.Errorf("error renaming user: %w", err)
+	}
+
+	if newPassword != "" {
+		_, err = tx.Exec(fmt.Sprintf(
+			"ALTER ROLE \"%s\" WITH PASSWORD '%s'",
+			newName, newPassword))
+		if err != nil {
+			return fmt.Errorf("error updating user password: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing rename: %w", err)
+	}
+	return nil
+}
+
+// SetUserReadOnly toggles default_transaction_read_only for username in
+// every database, terminateSessions kicks existing sessions so the change
+// takes effect immediately.
+func (c *PostgresController) SetUserReadOnly(username string, readOnly, terminateSessions bool) error {
+	var err error
+	if readOnly {
+		err = c.SetRoleSetting(username, "", "default_transaction_read_only", "on")
+	} else {
+		err = c.ResetRoleSetting(username, "", "default_transaction_read_only")
+	}
+	if err != nil {
+		return err
+	}
+
+	if terminateSessions {
+		return c.terminateUserConnections(username)
+	}
+	return nil
+}
+
+func (c *PostgresController) UserReadOnly(username string) (bool, error) {
+	settings, err := c.GetRoleSettings(username)
+	if err != nil {
+		return false, err
+	}
+
+	for _, setting := range settings {
+		if setting.Database == "" && setting.Name == "default_transaction_read_only" {
+			return settingEnabled(setting.Value), nil
+		}
+	}
+	return false, nil
+}
+
+type UserInfo struct {
+	Name            string
+	Superuser       bool
+	CanLogin        bool
+	CreateDB        bool
+	CreateRole      bool
+	ConnectionLimit int
+	// MemberOf lists the roles username is a member of, except the built-in
+	// pg_* ones, which are in PredefinedRoles
+	MemberOf        []string
+	PredefinedRoles []string
+}
+
+func (c *PostgresController) DescribeUser(username string) (UserInfo, error) {
+	if err := validateUsername(username); err != nil {
+		return UserInfo{}, err
+	}
+
+	info := UserInfo{Name: username}
+	err := c.db.QueryRow(`
+		SELECT rolsuper, rolcanlogin, rolcreatedb, rolcreaterole, rolconnlimit
+		FROM pg_roles
+		WHERE rolname = $1
+	`, username).Scan(&info.Superuser, &info.CanLogin, &info.CreateDB, &info.CreateRole, &info.ConnectionLimit)
+	if err == sql.ErrNoRows {
+		return UserInfo{}, ErrUserDoesNotExist
+	}
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("error describing user: %w", err)
+	}
+
+	// Predefined roles have OIDs below FirstNormalObjectId. Since PostgreSQL
+	// 16 a membership has a row per grantor.
+	rows, err := c.db.Query(`
+		SELECT DISTINCT r.rolname, r.oid < 16384 AND r.rolname LIKE 'pg\_%'
+		FROM pg_auth_members m
+		JOIN pg_roles r ON r.oid = m.roleid
+		JOIN pg_roles u ON u.oid = m.member
+		WHERE u.rolname = $1
+		ORDER BY r.rolname
+	`, username)
+	if err != nil {
+		return UserInfo{}, fmt.Errorf("error listing role memberships: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var role string
+		var predefined bool
+		if err := rows.Scan(&role, &predefined); err != nil {
+			return UserInfo{}, fmt.Errorf("error scanning role membership: %w", err)
+		}
+		if predefined {
+			info.PredefinedRoles = append(info.PredefinedRoles, role)
+		} else {
+			info.MemberOf = append(info.MemberOf, role)
+		}
+	}
+
+	return info, rows.Err()
+}
+
+func (c *PostgresController) terminateUserConnections(username string) error {
+	_, err := c.db.Exec(`
+		SELECT pg_terminate_backend(pid)
+		FROM pg_stat_activity
+		WHERE usename = $1
+		AND pid <> pg_backend_pid()`, username)
+	if err != nil {
+		return fmt.Errorf("error terminating user connections: %w", err)
+	}
+	return nil
+}
+
 func (c *PostgresController) ListUsers() ([]string, error) {
 	rows, err := c.db.Query(`
 		SELECT rolname
@@ -195,12 +414,18 @@ func (c *PostgresController) UserExists(username string) (bool, error) {
 		return false, err
 	}
 
+	return c.roleExists(username)
+}
+
+// roleExists is UserExists without the username validation, for roles that
+// may be reserved such as a grantor
+func (c *PostgresController) roleExists(name string) (bool, error) {
 	var exists bool
-	err = c.db.QueryRow(`
+	err := c.db.QueryRow(`
 		SELECT EXISTS(
 			SELECT 1 FROM pg_roles
 			WHERE rolname = $1
-		)`, username).Scan(&exists)
+		)`, name).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("error checking if user exists: %w", err)
 	}
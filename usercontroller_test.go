@@ -2,7 +2,9 @@
 package postgresctl
 
 import (
+	"crypto/md5"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"testing"
 
@@ -219,3 +221,109 @@ func TestPostgresController_UsersMaxConnHandling(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, -1, maxConn)
 }
+
+func TestPostgresController_RenameUser(t *testing.T) {
+	oldName := testUser()
+	newName := testUser()
+	testPassword := testPassword()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.RenameUser(oldName, newName, "")
+	assert.Equal(t, ErrUserDoesNotExist, err)
+
+	err = c.CreateUser(oldName, testPassword)
+	assert.NoError(t, err)
+
+	// Force an MD5 password, which PostgreSQL clears on rename
+	sum := md5.Sum([]byte(testPassword + oldName))
+	_, err = c.db.Exec(fmt.Sprintf(`ALTER ROLE "%s" PASSWORD 'md5%s'`, oldName, hex.EncodeToString(sum[:])))
+	assert.NoError(t, err)
+
+	err = c.RenameUser(oldName, newName, "")
+	assert.Equal(t, ErrPasswordRequired, err)
+
+	newPassword := testPassword + "_new"
+	err = c.RenameUser(oldName, newName, newPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUser(newName)
+
+	exists, err := c.UserExists(oldName)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	err = openPostgres(newName, newPassword, "postgres")
+	assert.NoError(t, err)
+
+	otherName := testUser()
+	err = c.CreateUser(otherName, testPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUser(otherName)
+
+	err = c.RenameUser(otherName, newName, testPassword)
+	assert.Equal(t, ErrUserExists, err)
+
+	// A failed rename changes nothing
+	err = openPostgres(otherName, testPassword, "postgres")
+	assert.NoError(t, err)
+
+	for _, name := range baseUsers {
+		err = c.RenameUser(name, oldName, testPassword)
+		assert.Error(t, err)
+
+		err = c.RenameUser(newName, name, testPassword)
+		assert.Error(t, err)
+	}
+}
+
+func TestPostgresController_SetUserReadOnly(t *testing.T) {
+	testUser := testUser()
+	testPassword := testPassword()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.SetUserReadOnly(testUser, true, false)
+	assert.Equal(t, ErrUserDoesNotExist, err)
+
+	err = c.CreateUser(testUser, testPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	_, err = c.db.Exec(fmt.Sprintf(`GRANT CREATE ON SCHEMA public TO "%s"`, testUser))
+	assert.NoError(t, err)
+
+	readOnly, err := c.UserReadOnly(testUser)
+	assert.NoError(t, err)
+	assert.False(t, readOnly)
+
+	db, err := sql.Open("postgres", fmt.Sprintf("postgres://%s:%s@localhost:55432/postgres?sslmode=disable", testUser, testPassword))
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, db.Ping())
+
+	err = c.SetUserReadOnly(testUser, true, true)
+	assert.NoError(t, err)
+
+	readOnly, err = c.UserReadOnly(testUser)
+	assert.NoError(t, err)
+	assert.True(t, readOnly)
+
+	// The first call hits the terminated session, the second a fresh read-only one
+	_, _ = db.Exec("SELECT 1")
+	_, err = db.Exec("CREATE TABLE read_only_test (id INT)")
+	assert.Error(t, err)
+
+	err = c.SetUserReadOnly(testUser, false, true)
+	assert.NoError(t, err)
+
+	readOnly, err = c.UserReadOnly(testUser)
+	assert.NoError(t, err)
+	assert.False(t, readOnly)
+
+	for _, name := range baseUsers {
+		err = c.SetUserReadOnly(name, true, false)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,291 @@
+// postgresctl/watchdog.go
+package postgresctl
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type WatchdogAction string
+
+const (
+	WatchdogActionCancel    WatchdogAction = "cancel"
+	WatchdogActionTerminate WatchdogAction = "terminate"
+)
+
+const (
+	WatchdogReasonQueryDuration     = "query_duration"
+	WatchdogReasonIdleInTransaction = "idle_in_transaction"
+)
+
+const defaultWatchdogInterval = 30 * time.Second
+
+var (
+	ErrInvalidWatchdogRule = fmt.Errorf("invalid watchdog rule")
+)
+
+// WatchdogRule describes which sessions are considered offenders.
+// Empty Database or Username match any database or user.
+// Sessions idle in a transaction are always terminated, because cancelling
+// them has no effect; Action only applies to long-running queries.
+type WatchdogRule struct {
+	Name                 string
+	Database             string
+	Username             string
+	MaxQueryDuration     time.Duration
+	MaxIdleInTransaction time.Duration
+	Action               WatchdogAction
+}
+
+// WatchdogEvent describes what the watchdog did (or would have done in
+// dry-run mode) with an offending session.
+type WatchdogEvent struct {
+	Time     time.Time
+	Rule     string
+	PID      int
+	Database string
+	Username string
+	State    string
+	Query    string
+	Duration time.Duration
+	Reason   string
+	Action   WatchdogAction
+	DryRun   bool
+	Err      error
+}
+
+type Watchdog struct {
+	c        *PostgresController
+	rules    []WatchdogRule
+	interval time.Duration
+	dryRun   bool
+	skipOwn  bool
+	handler  func(WatchdogEvent)
+}
+
+type WatchdogOption func(*Watchdog)
+
+func WithWatchdogInterval(interval time.Duration) WatchdogOption {
+	return func(w *Watchdog) {
+		w.interval = interval
+	}
+}
+
+func WithWatchdogDryRun(dryRun bool) WatchdogOption {
+	return func(w *Watchdog) {
+		w.dryRun = dryRun
+	}
+}
+
+// WithWatchdogSkipOwnRole leaves every session of the controller's role alone,
+// not only the connection the watchdog scans from.
+func WithWatchdogSkipOwnRole(skip bool) WatchdogOption {
+	return func(w *Watchdog) {
+		w.skipOwn = skip
+	}
+}
+
+func WithWatchdogHandler(handler func(WatchdogEvent)) WatchdogOption {
+	return func(w *Watchdog) {
+		w.handler = handler
+	}
+}
+
+type activitySession struct {
+	pid           int
+	database      string
+	username      string
+	state         string
+	query         string
+	queryDuration time.Duration
+	stateDuration time.Duration
+}
+
+func NewWatchdog(c *PostgresController, rules []WatchdogRule, opts ...WatchdogOption) (*Watchdog, error) {
+	for i, rule := range rules {
+		if err := validateWatchdogRule(rule); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+
+	w := &Watchdog{c: c, rules: rules, interval: defaultWatchdogInterval}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	if w.interval <= 0 {
+		return nil, fmt.Errorf("watchdog interval must be positive")
+	}
+
+	return w, nil
+}
+
+// Run scans pg_stat_activity every interval until ctx is done.
+// Scan errors are reported to the handler as events with Err set.
+func (w *Watchdog) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.Scan(); err != nil {
+			w.emit(WatchdogEvent{Time: time.Now(), DryRun: w.dryRun, Err: err})
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan runs a single pass over pg_stat_activity and acts on every offender.
+func (w *Watchdog) Scan() ([]WatchdogEvent, error) {
+	sessions, err := w.c.activeSessions(w.skipOwn)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []WatchdogEvent
+	for _, s := range sessions {
+		for _, rule := range w.rules {
+			reason, duration, ok := matchWatchdogRule(rule, s)
+			if !ok {
+				continue
+			}
+
+			event := WatchdogEvent{
+				Time:     time.Now(),
+				Rule:     rule.Name,
+				PID:      s.pid,
+				Database: s.database,
+				Username: s.username,
+				State:    s.state,
+				Query:    s.query,
+				Duration: duration,
+				Reason:   reason,
+				Action:   watchdogAction(rule, reason),
+				DryRun:   w.dryRun,
+			}
+			if !w.dryRun {
+				event.Err = w.c.signalBackend(event.PID, event.Action)
+			}
+
+			w.emit(event)
+			events = append(events, event)
+			break
+		}
+	}
+
+	return events, nil
+}
+
+func (w *Watchdog) emit(event WatchdogEvent) {
+	if w.handler != nil {
+		w.handler(event)
+	}
+}
+
+func (c *PostgresController) activeSessions(skipOwnRole bool) ([]activitySession, error) {
+	rows, err := c.db.Query(`
+		SELECT pid,
+			COALESCE(datname, ''),
+			COALESCE(usename, ''),
+			COALESCE(state, ''),
+			COALESCE(query, ''),
+			COALESCE(EXTRACT(EPOCH FROM (now() - query_start)), 0)::float8,
+			COALESCE(EXTRACT(EPOCH FROM (now() - state_change)), 0)::float8
+		FROM pg_stat_activity
+		WHERE backend_type = 'client backend'
+		AND pid <> pg_backend_pid()
+		AND NOT ($1 AND usename = current_user)
+		AND state IN ('active', 'idle in transaction', 'idle in transaction (aborted)')
+	`, skipOwnRole)
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []activitySession
+	for rows.Next() {
+		var s activitySession
+		var querySeconds, stateSeconds float64
+		err = rows.Scan(&s.pid, &s.database, &s.username, &s.state, &s.query, &querySeconds, &stateSeconds)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning session: %w", err)
+		}
+		s.queryDuration = time.Duration(querySeconds * float64(time.Second))
+		s.stateDuration = time.Duration(stateSeconds * float64(time.Second))
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (c *PostgresController) signalBackend(pid int, action WatchdogAction) error {
+	fn := "pg_cancel_backend"
+	if action == WatchdogActionTerminate {
+		fn = "pg_terminate_backend"
+	}
+
+	var signalled bool
+	err := c.db.QueryRow(`SELECT `+fn+`($1)`, pid).Scan(&signalled)
+	if err != nil {
+		return fmt.Errorf("error signalling backend %d: %w", pid, err)
+	}
+	if !signalled {
+		return fmt.Errorf("backend %d is gone", pid)
+	}
+	return nil
+}
+
+func matchWatchdogRule(rule WatchdogRule, s activitySession) (string, time.Duration, bool) {
+	if rule.Database != "" && rule.Database != s.database {
+		return "", 0, false
+	}
+	if rule.Username != "" && rule.Username != s.username {
+		return "", 0, false
+	}
+
+	switch s.state {
+	case "active":
+		if rule.MaxQueryDuration > 0 && s.queryDuration > rule.MaxQueryDuration {
+			return WatchdogReasonQueryDuration, s.queryDuration, true
+		}
+	case "idle in transaction", "idle in transaction (aborted)":
+		if rule.MaxIdleInTransaction > 0 && s.stateDuration > rule.MaxIdleInTransaction {
+			return WatchdogReasonIdleInTransaction, s.stateDuration, true
+		}
+	}
+
+	return "", 0, false
+}
+
+func watchdogAction(rule WatchdogRule, reason string) WatchdogAction {
+	if reason == WatchdogReasonIdleInTransaction {
+		return WatchdogActionTerminate
+	}
+	if rule.Action == "" {
+		return WatchdogActionCancel
+	}
+	return rule.Action
+}
+
+func validateWatchdogRule(rule WatchdogRule) error {
+	if rule.MaxQueryDuration <= 0 && rule.MaxIdleInTransaction <= 0 {
+		return fmt.Errorf("%w: no limits set", ErrInvalidWatchdogRule)
+	}
+	if rule.MaxQueryDuration < 0 || rule.MaxIdleInTransaction < 0 {
+		return fmt.Errorf("%w: negative limit", ErrInvalidWatchdogRule)
+	}
+
+	switch rule.Action {
+	case "", WatchdogActionCancel, WatchdogActionTerminate:
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidWatchdogRule, rule.Action)
+	}
+
+	return nil
+}
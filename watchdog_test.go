@@ -0,0 +1,159 @@
+// postgresctl/watchdog_test.go
+package postgresctl
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchWatchdogRule(t *testing.T) {
+	rule := WatchdogRule{
+		Name:                 "tenants",
+		Database:             "tenant_db",
+		MaxQueryDuration:     time.Minute,
+		MaxIdleInTransaction: 10 * time.Second,
+	}
+
+	active := activitySession{database: "tenant_db", username: "u", state: "active", queryDuration: 2 * time.Minute}
+	reason, duration, ok := matchWatchdogRule(rule, active)
+	assert.True(t, ok)
+	assert.Equal(t, WatchdogReasonQueryDuration, reason)
+	assert.Equal(t, 2*time.Minute, duration)
+	assert.Equal(t, WatchdogActionCancel, watchdogAction(rule, reason))
+
+	idle := activitySession{database: "tenant_db", username: "u", state: "idle in transaction", stateDuration: time.Minute}
+	reason, _, ok = matchWatchdogRule(rule, idle)
+	assert.True(t, ok)
+	assert.Equal(t, WatchdogReasonIdleInTransaction, reason)
+	assert.Equal(t, WatchdogActionTerminate, watchdogAction(rule, reason))
+
+	short := activitySession{database: "tenant_db", state: "active", queryDuration: time.Second}
+	_, _, ok = matchWatchdogRule(rule, short)
+	assert.False(t, ok)
+
+	otherDB := activitySession{database: "other_db", state: "active", queryDuration: time.Hour}
+	_, _, ok = matchWatchdogRule(rule, otherDB)
+	assert.False(t, ok)
+}
+
+func TestNewWatchdog_InvalidRules(t *testing.T) {
+	c := createTestController()
+	defer c.Close()
+
+	_, err := NewWatchdog(c, []WatchdogRule{{Name: "empty"}})
+	assert.ErrorIs(t, err, ErrInvalidWatchdogRule)
+
+	_, err = NewWatchdog(c, []WatchdogRule{{MaxQueryDuration: time.Second, Action: "kill"}})
+	assert.ErrorIs(t, err, ErrInvalidWatchdogRule)
+
+	_, err = NewWatchdog(c, []WatchdogRule{{MaxQueryDuration: time.Second}}, WithWatchdogInterval(0))
+	assert.Error(t, err)
+}
+
+func TestWatchdog_IdleInTransaction(t *testing.T) {
+	testDB := testDB()
+	testUser := testUser()
+	testPassword := testPassword()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateUser(testUser, testPassword)
+	assert.NoError(t, err)
+	defer c.DeleteUser(testUser)
+
+	err = c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	db, err := sql.Open("postgres", fmt.Sprintf("postgres://%s:%s@localhost:55432/%s?sslmode=disable", testUser, testPassword, testDB))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	_, err = tx.Exec("SELECT 1")
+	assert.NoError(t, err)
+
+	time.Sleep(2 * time.Second)
+
+	rules := []WatchdogRule{{Name: "idle", Database: testDB, MaxIdleInTransaction: time.Second}}
+
+	// Dry run reports the session but leaves it alone
+	var handled []WatchdogEvent
+	w, err := NewWatchdog(c, rules, WithWatchdogDryRun(true), WithWatchdogHandler(func(e WatchdogEvent) {
+		handled = append(handled, e)
+	}))
+	assert.NoError(t, err)
+
+	events, err := w.Scan()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, events, handled)
+	assert.True(t, events[0].DryRun)
+	assert.Equal(t, testUser, events[0].Username)
+	assert.Equal(t, WatchdogReasonIdleInTransaction, events[0].Reason)
+
+	_, err = tx.Exec("SELECT 1")
+	assert.NoError(t, err)
+
+	time.Sleep(2 * time.Second)
+
+	// Real run terminates the session
+	w, err = NewWatchdog(c, rules)
+	assert.NoError(t, err)
+
+	events, err = w.Scan()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(events))
+	assert.NoError(t, events[0].Err)
+	assert.Equal(t, WatchdogActionTerminate, events[0].Action)
+
+	err = tx.Commit()
+	assert.Error(t, err)
+}
+
+func TestWatchdog_SkipOwnRole(t *testing.T) {
+	testDB := testDB()
+
+	c := createTestController()
+	defer c.Close()
+
+	err := c.CreateDatabase(testDB)
+	assert.NoError(t, err)
+	defer c.DeleteDatabase(testDB)
+
+	// A session of the controller's own role, other than the one scanning
+	db, err := c.openDB(testDB)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.Exec("SELECT 1")
+	assert.NoError(t, err)
+
+	time.Sleep(2 * time.Second)
+
+	rules := []WatchdogRule{{Name: "idle", Database: testDB, MaxIdleInTransaction: time.Second}}
+
+	w, err := NewWatchdog(c, rules, WithWatchdogDryRun(true))
+	assert.NoError(t, err)
+
+	events, err := w.Scan()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(events))
+
+	w, err = NewWatchdog(c, rules, WithWatchdogDryRun(true), WithWatchdogSkipOwnRole(true))
+	assert.NoError(t, err)
+
+	events, err = w.Scan()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(events))
+}